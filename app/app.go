@@ -0,0 +1,1734 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+// Package app provides the main application logic for the ShowAllFiles utility.
+// It manages initialization, configuration, logging, environment variables, and the system tray UI.
+// The Application struct encapsulates the application's error channel, metadata, and library functions.
+// Key features include:
+//   - Command-line flag parsing for logging, verbosity, and version display.
+//   - Environment variable handling for debugging and runtime configuration.
+//   - Logger setup with support for file output and log rotation.
+//   - System tray integration with menu items for toggling hidden files, displaying about information, and quitting.
+//   - Global hotkey registration for toggling hidden files visibility.
+//   - Message box utilities for error and information dialogs.
+//   - Console management for verbose output and debugging.
+//
+// The package is designed for Windows and interacts with the Windows registry and system APIs. Besides running the
+// application (see New and Run), another Go program can embed the toggle logic through a Library (see NewLibrary).
+package app
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/getlantern/systray"
+	"github.com/kamaranl/showallfiles/internal/console"
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"golang.design/x/hotkey"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const regKeyPath = `Software\Microsoft\Windows\CurrentVersion\Explorer\Advanced`
+
+// Exit codes returned by the application, allowing scripts to reliably branch on the outcome.
+const (
+	// ExitOK indicates the application completed successfully (e.g., --version or a normal quit).
+	ExitOK = 0
+
+	// ExitFatal indicates a fatal runtime error, such as failing to read the registry or to set up the console.
+	ExitFatal = 1
+
+	// ExitUsage indicates invalid command-line usage, such as an unknown argument or an invalid flag value.
+	ExitUsage = 2
+
+	// ExitConfig indicates the configuration file could not be read or contains invalid settings.
+	ExitConfig = 3
+)
+
+const (
+	statusVisible uint64 = iota + 1
+	statusHidden
+)
+
+const (
+	// hotkeyAttempts is the number of times registering the global hotkey is attempted before giving up.
+	hotkeyAttempts = 5
+
+	// hotkeyBackoff is the initial delay between hotkey registration attempts; it doubles after each attempt.
+	hotkeyBackoff = 250 * time.Millisecond
+)
+
+// shutdownTimeout is how long onExit waits for background goroutines to release their hooks and handles.
+const shutdownTimeout = 2 * time.Second
+
+// Console modes selectable with --console.
+const (
+	consoleAttach = "attach"
+	consoleSpawn  = "spawn"
+	consoleNone   = "none"
+)
+
+// Toggle feedback modes selectable with --toggle-feedback.
+const (
+	feedbackNone  = "none"
+	feedbackSound = "sound"
+	feedbackFlash = "flash"
+)
+
+// Refresh modes selectable with --refresh-mode.
+const (
+	refreshMessage = "message"
+	refreshCOM     = "com"
+)
+
+// Startup states selectable with --startup-state.
+const (
+	startupKeep = "keep"
+	startupShow = "show"
+	startupHide = "hide"
+)
+
+// Registry watch modes selectable with --watch-mode.
+const (
+	watchEvent = "event"
+	watchPoll  = "poll"
+)
+
+// defaultAboutTemplate is the text/template used for the About dialog unless overridden.
+// It has access to the Name, Version, License, OS, and Arch fields of aboutData.
+const defaultAboutTemplate = "{{.Name}}, version {{.Version}} ({{.OS}}-{{.Arch}}){{.License}}"
+
+// defaultReportURL is the page opened by the "Report bug" menu item unless Meta.ReportURL is overridden.
+const defaultReportURL = "https://github.com/kamaranl/showallfiles/issues"
+
+// persistedKeys lists the state entries that are saved to disk and restored on the next run.
+var persistedKeys = []string{"first_run_done", "original_hidden"}
+
+var (
+	con    *console.Console
+	log    *logrus.Logger
+	logBuf *logBuffer
+	flag   struct {
+		AboutTemplate         string
+		Accelerators          string
+		AttachPid             uint32
+		AuditLog              string
+		Config                string
+		ConfirmQuit           bool
+		Console               string
+		DumpWindows           bool
+		ExportSettings        string
+		Force                 bool
+		HTTP                  string
+		IdleExit              time.Duration
+		ImportSettings        string
+		Indicator             bool
+		InstallService        bool
+		LogBuffer             time.Duration
+		LogColor              string
+		LogFile               string
+		LogLevel              string
+		LogTimestamp          string
+		LogUTC                bool
+		Menu                  []string
+		NoDoubleClick         bool
+		NoRefresh             bool
+		NoRefreshFolders      []string
+		NoStatusLine          bool
+		NoTray                bool
+		NoWatch               bool
+		NoWelcome             bool
+		OnToggle              string
+		Output                string
+		PollInterval          time.Duration
+		PrintConfig           string
+		ReadOnly              bool
+		ReconcileInterval     time.Duration
+		Refresh               bool
+		RefreshClasses        []string
+		RefreshForegroundOnly bool
+		RefreshMode           string
+		RefreshUnverified     bool
+		RestoreOnExit         bool
+		SelfTest              bool
+		SetConfig             string
+		SetDword              string
+		SettleDelay           time.Duration
+		ShowFolders           []string
+		StartupState          string
+		Status                bool
+		Stress                int
+		Temporary             bool
+		TemporaryDuration     time.Duration
+		ToggleDword           string
+		ToggleFeedback        string
+		UninstallService      bool
+		Verbose               bool
+		Version               bool
+		WatchDebounce         time.Duration
+		WatchMode             string
+	}
+	env   map[string]string
+	debug bool
+
+	//go:embed icons/ShowAllFiles1.ico
+	icoVisible []byte
+
+	//go:embed icons/ShowAllFiles2.ico
+	icoHidden []byte
+
+	//go:embed icons/ShowAllFiles1-*.ico icons/ShowAllFiles2-*.ico
+	trayIcons embed.FS
+)
+
+// LogFormatter is a custom log formatter that embeds logrus.TextFormatter,
+// allowing for additional customization of log output formatting.
+// If UTC is set, timestamps are written in UTC rather than local time.
+type LogFormatter struct {
+	logrus.TextFormatter
+	UTC bool
+}
+
+// Format formats a logrus.Entry by replacing all double quotes in the message with single quotes (and converting
+// its time to UTC if UTC is set), then delegates formatting to the embedded TextFormatter.
+// Returns the formatted log entry as a byte slice. If formatting fails, an error is returned.
+func (f *LogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	entry.Message = strings.ReplaceAll(entry.Message, `"`, `'`)
+	if f.UTC {
+		entry.Time = entry.Time.UTC()
+	}
+	b, err := f.TextFormatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Application represents the main application structure, containing channels for error handling,
+// an API implementation for managing library operations, and metadata such as the application's name, version, and license.
+// Lib defaults to a *Library but can be replaced with any other API implementation (e.g., a test double).
+// The Library reads its settings from Config and logs through Logger rather than package-level globals, so a program
+// embedding the package can call its methods (e.g., ToggleHidden) with its own configuration and Logger implementation.
+type Application struct {
+	Audit  io.Writer // receives the JSONL audit log of writes of "Hidden" (--audit-log); disabled if nil
+	Config Config
+	ErrCh  chan error
+	Lib    API
+	Logger Logger
+	Meta   struct {
+		About     string // text/template for the About dialog; defaultAboutTemplate if empty
+		License   string
+		Name      string
+		ReportURL string // page opened by "Report bug"; defaultReportURL unless overridden
+		Version   string
+	}
+
+	auditMu     sync.Mutex
+	batchMu     sync.Mutex // serializes POST /batch requests (see handleBatch)
+	done        chan struct{}
+	doneOnce    sync.Once
+	hotkeyBound bool     // whether the listener of the toggle hotkey was started (see listenHotkey)
+	menu        []string // items of the tray menu once onReady built it (see menuLayout)
+	quit        chan struct{}
+	regrab      chan chan error // requests to re-register the toggle hotkey, served by its listener (see regrabHotkey)
+	wg          sync.WaitGroup  // goroutines holding hooks or handles that onExit waits for (see goTracked)
+}
+
+// Logger is the minimal logging interface used by the Library. Application.Logger defaults to the package's
+// logrus logger, but an embedding program can plug in its own implementation.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+var _ Logger = (*logrus.Logger)(nil)
+
+// Config holds the settings that control the behavior of a Library.
+// New populates it from the command-line flags, and Run updates it once the configuration file has been applied.
+type Config struct {
+	KeyPath               string        // registry key under HKEY_CURRENT_USER (or the hive of UserSID) holding "Hidden"
+	NoRefresh             bool          // whether File Explorer windows are left alone after a change (--no-refresh)
+	NoRefreshFolders      []string      // folders whose File Explorer tabs are not refreshed (--no-refresh-folder)
+	NoTray                bool          // whether the systray is unavailable (--no-tray)
+	NoWatch               bool          // whether the registry watcher is not started (--no-watch)
+	OnToggle              string        // command run after a successful toggle (--on-toggle)
+	ReadOnly              bool          // whether toggling is disabled, leaving only the status display (--read-only)
+	PollInterval          time.Duration // interval between registry reads when WatchMode is "poll" (--poll-interval)
+	RefreshClasses        []string      // window classes of third-party file managers to refresh (--refresh-class)
+	RefreshMode           string        // how File Explorer windows are refreshed: "message" or "com" (--refresh-mode)
+	RefreshUnverified     bool          // treat unverifiable "CabinetWClass" windows as File Explorer (--refresh-unverified)
+	RefreshForegroundOnly bool          // refresh only the foreground window after a change (--refresh-foreground-only)
+	SettleDelay           time.Duration // wait between writing "Hidden" and refreshing windows (--settle-delay)
+	ShowFolders           []string      // folders that show hidden files while in the foreground (--show-in-folder)
+	ToggleFeedback        string        // confirmation of a toggle: "none", "sound", or "flash" (--toggle-feedback)
+	UserSID               string        // user whose hive under HKEY_USERS holds KeyPath; the current user's if empty
+	WatchDebounce         time.Duration // wait for further toggles before writing "Hidden" once (--watch-debounce)
+	WatchMode             string        // how registry changes are detected: "event" or "poll" (--watch-mode)
+}
+
+// configFromFlags returns the Config described by the current values of the command-line flags.
+func configFromFlags() Config {
+	return Config{
+		KeyPath:               regKeyPath,
+		NoRefresh:             flag.NoRefresh,
+		NoRefreshFolders:      flag.NoRefreshFolders,
+		NoTray:                flag.NoTray,
+		NoWatch:               flag.NoWatch,
+		OnToggle:              flag.OnToggle,
+		ReadOnly:              flag.ReadOnly,
+		PollInterval:          flag.PollInterval,
+		RefreshClasses:        flag.RefreshClasses,
+		RefreshMode:           flag.RefreshMode,
+		RefreshUnverified:     flag.RefreshUnverified,
+		RefreshForegroundOnly: flag.RefreshForegroundOnly,
+		SettleDelay:           flag.SettleDelay,
+		ShowFolders:           flag.ShowFolders,
+		ToggleFeedback:        flag.ToggleFeedback,
+		WatchDebounce:         flag.WatchDebounce,
+		WatchMode:             flag.WatchMode,
+	}
+}
+
+// aboutData holds the values available to the About dialog template.
+type aboutData struct {
+	Name, Version, License, OS, Arch string
+}
+
+// DefaultConfig returns the Config described by the defaults of the command-line flags, i.e., the settings used when
+// no flag is given, watching "Hidden" under the usual registry key.
+func DefaultConfig() Config {
+	return Config{
+		KeyPath:        regKeyPath,
+		PollInterval:   defaultPollInterval,
+		RefreshMode:    refreshMessage,
+		SettleDelay:    defaultSettleDelay,
+		ToggleFeedback: feedbackNone,
+		WatchDebounce:  defaultWatchDebounce,
+		WatchMode:      watchEvent,
+	}
+}
+
+// New creates a new Application instance with the specified name.
+// It initializes the channels, the Config (see DefaultConfig; Run replaces it with the one described by the
+// command-line flags), and the Logger (the package logger, which is configured by Run), defaults Meta.ReportURL to
+// defaultReportURL, and associates a concrete *Library with the application as its API.
+// An Application must be created with New (or NewLibrary), since the Library relies on its channels.
+// Returns a pointer to the newly created Application.
+func New(name string) *Application {
+	app := &Application{
+		Config: DefaultConfig(),
+		ErrCh:  make(chan error),
+		Logger: log,
+		done:   make(chan struct{}),
+		quit:   make(chan struct{}, 1),
+		regrab: make(chan chan error),
+	}
+	app.Meta.Name = name
+	app.Meta.ReportURL = defaultReportURL
+	app.Lib = &Library{App: app}
+
+	return app
+}
+
+// NewLibrary creates a Library for a program embedding the package, e.g., to call ToggleHidden or
+// RefreshExplorerWindows without the system tray or the command line. The Library belongs to an Application created
+// with New, with config (e.g., DefaultConfig with NoTray set) and logger in place of the command-line flags and the
+// package logger. Errors of the watchers it starts (e.g., WatchRegistryKey) are sent to App.ErrCh, which the caller
+// must receive from, and the watchers run until Stop is called.
+//
+// Parameters:
+//
+//	name   - The name of the embedding program, used for the same purposes as the name given to New.
+//	config - The settings of the Library.
+//	logger - Receives the log messages of the Library.
+func NewLibrary(name string, config Config, logger Logger) *Library {
+	app := New(name)
+	app.Config = config
+	app.Logger = logger
+
+	return app.Lib.(*Library)
+}
+
+// Stop stops the watchers started by the Library (e.g., WatchRegistryKey) and waits for those holding hooks or
+// handles to return. It is meant for a Library created with NewLibrary; Run stops them itself when exiting.
+func (l *Library) Stop() {
+	l.App.stop()
+	l.App.wg.Wait()
+}
+
+// Run starts the main execution flow of the Application.
+// It attaches the console, parses command-line arguments, applies the configuration file, handles version display,
+// checks for required environment variables, sets up logging, and launches the system tray.
+// If invalid arguments or missing environment variables are detected, it displays appropriate
+// error messages and exits the application.
+func (a *Application) Run() {
+	_ = con.Attach()
+	parseFlags()
+
+	if pflag.Arg(0) != "" {
+		pflag.Usage()
+
+		if !strings.EqualFold(pflag.Arg(0), "help") && pflag.Arg(0) != "?" {
+			fmt.Fprintf(os.Stderr, "unknown arg: %s\n", pflag.Arg(0))
+		}
+
+		os.Exit(ExitUsage)
+	}
+	if flag.SetConfig != "" {
+		// before loadConfig, so that a setting can be fixed even if the configuration is invalid
+		os.Exit(setConfig(a.Meta.Name, flag.SetConfig))
+	}
+	if err := loadConfig(a.Meta.Name); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(ExitConfig)
+	}
+	a.Config = configFromFlags()
+	switch flag.Output {
+	case outputTable, outputJSON:
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid output format: %s\n", flag.Output)
+		os.Exit(ExitUsage)
+	}
+	switch flag.PrintConfig {
+	case "":
+	case outputTable:
+		// --print-config without a format follows --output
+		os.Exit(printConfig(outputFormat(outputTable)))
+	case outputJSON:
+		os.Exit(printConfig(outputJSON))
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid print-config format: %s\n", flag.PrintConfig)
+		os.Exit(ExitUsage)
+	}
+	if flag.Version {
+		fmt.Fprintln(os.Stderr, a.Meta.Version)
+		os.Exit(ExitOK)
+	}
+	switch flag.Console {
+	case "", consoleAttach, consoleSpawn, consoleNone:
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid console mode: %s\n", flag.Console)
+		os.Exit(ExitUsage)
+	}
+	switch flag.ToggleFeedback {
+	case feedbackNone, feedbackSound, feedbackFlash:
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid toggle feedback: %s\n", flag.ToggleFeedback)
+		os.Exit(ExitUsage)
+	}
+	if flag.LogTimestamp != "" && (time.Time{}).Format(flag.LogTimestamp) == flag.LogTimestamp {
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid log timestamp format: %q has no time elements\n", flag.LogTimestamp)
+		os.Exit(ExitUsage)
+	}
+	switch flag.LogColor {
+	case colorAuto, colorAlways, colorNever:
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid log color: %s\n", flag.LogColor)
+		os.Exit(ExitUsage)
+	}
+	if flag.Accelerators != "" {
+		if _, err := parseModifiers(flag.Accelerators); err != nil {
+			pflag.Usage()
+			fmt.Fprintf(os.Stderr, "invalid accelerators: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+	}
+	if flag.SettleDelay < 0 {
+		fmt.Fprintln(os.Stderr, "--settle-delay must not be negative")
+		os.Exit(ExitUsage)
+	}
+	if flag.WatchDebounce < 0 {
+		fmt.Fprintln(os.Stderr, "--watch-debounce must not be negative")
+		os.Exit(ExitUsage)
+	}
+	if flag.IdleExit < 0 {
+		fmt.Fprintln(os.Stderr, "--idle-exit must not be negative")
+		os.Exit(ExitUsage)
+	}
+	if flag.HTTP != "" {
+		if err := checkLoopback(flag.HTTP); err != nil {
+			pflag.Usage()
+			fmt.Fprintf(os.Stderr, "invalid http address: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+	}
+	switch flag.RefreshMode {
+	case refreshMessage, refreshCOM:
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid refresh mode: %s\n", flag.RefreshMode)
+		os.Exit(ExitUsage)
+	}
+	switch flag.StartupState {
+	case startupKeep, startupShow, startupHide:
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid startup state: %s\n", flag.StartupState)
+		os.Exit(ExitUsage)
+	}
+	switch flag.WatchMode {
+	case watchEvent:
+	case watchPoll:
+		if flag.PollInterval <= 0 {
+			fmt.Fprintln(os.Stderr, "--poll-interval must be positive")
+			os.Exit(ExitUsage)
+		}
+	default:
+		pflag.Usage()
+		fmt.Fprintf(os.Stderr, "invalid watch mode: %s\n", flag.WatchMode)
+		os.Exit(ExitUsage)
+	}
+	if flag.ReadOnly {
+		for _, conflict := range []struct {
+			name string
+			set  bool
+		}{
+			{"--temporary", flag.Temporary},
+			{"--stress", flag.Stress > 0},
+			{"--restore-on-exit", flag.RestoreOnExit},
+			{"--startup-state", flag.StartupState != startupKeep},
+			{"--show-in-folder", len(flag.ShowFolders) > 0},
+		} {
+			if conflict.set {
+				fmt.Fprintf(os.Stderr, "%s cannot be used with --read-only\n", conflict.name)
+				os.Exit(ExitUsage)
+			}
+		}
+	}
+	if flag.AttachPid != 0 {
+		if consoleMode() != consoleAttach {
+			fmt.Fprintln(os.Stderr, "--attach-pid requires --console=attach")
+			os.Exit(ExitUsage)
+		}
+		if err := checkProcess(flag.AttachPid); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid attach pid: %v\n", err)
+			os.Exit(ExitUsage)
+		}
+	}
+	if env["SystemRoot"] == "" {
+		msg := `Environment variable "SystemRoot" not set`
+		fmt.Fprintln(os.Stderr, msg)
+		msgbox("Fatal Error", msg, windows.MB_OK|windows.MB_ICONERROR, ExitFatal)
+	}
+	if flag.AuditLog != "" {
+		a.Audit = &lumberjack.Logger{
+			Filename:   flag.AuditLog,
+			MaxBackups: 4,
+			MaxAge:     28,
+		}
+	}
+	if flag.ExportSettings != "" {
+		os.Exit(a.exportSettings(flag.ExportSettings))
+	}
+	if flag.ImportSettings != "" {
+		os.Exit(a.importSettings(flag.ImportSettings))
+	}
+	if flag.Refresh {
+		os.Exit(a.refreshWindows())
+	}
+	if flag.SetDword != "" {
+		os.Exit(a.setDword(flag.SetDword))
+	}
+	if flag.ToggleDword != "" {
+		os.Exit(a.toggleDword(flag.ToggleDword))
+	}
+	if flag.DumpWindows {
+		os.Exit(a.dumpWindows())
+	}
+	if flag.Status {
+		os.Exit(a.printStatus())
+	}
+	if flag.SelfTest {
+		os.Exit(a.selfTest())
+	}
+	if flag.Stress > 0 {
+		os.Exit(a.stress(flag.Stress))
+	}
+	if flag.InstallService {
+		os.Exit(a.installService())
+	}
+	if flag.UninstallService {
+		os.Exit(a.uninstallService())
+	}
+
+	setLogger(a.Meta.Name)
+	if err := state.Load(statePath(a.Meta.Name)); err != nil {
+		log.Warnf("Could not load persisted state: %v", err)
+	}
+	log.Debug("Application ready")
+
+	if isService, _ := svc.IsWindowsService(); isService {
+		a.runService()
+		return
+	}
+	if flag.Temporary {
+		a.runTemporary()
+		return
+	}
+
+	if flag.HTTP != "" {
+		if err := a.serveHTTP(flag.HTTP); err != nil {
+			msg := fmt.Sprintf("Error starting the HTTP control server: %v", err)
+			log.Error(msg)
+			msgbox("Fatal Error", msg, windows.MB_OK|windows.MB_ICONERROR, ExitFatal)
+			select {} // msgbox exits once dismissed
+		}
+	}
+
+	if flag.NoTray {
+		a.runHeadless()
+		return
+	}
+
+	if err := setDPIAware(); err != nil {
+		log.Debugf("Could not make the process DPI aware: %v", err)
+	}
+	systray.Run(a.onReady, a.onExit)
+}
+
+// runHeadless runs the application without a system tray, providing only the global hotkey and the registry watcher
+// (and the reconciliation loop, idle exit, folder rules, and indicator window, if enabled). It blocks until an
+// interrupt or termination signal is received, then performs the same cleanup as onExit. Errors sent to the
+// application's error channel are logged.
+func (a *Application) runHeadless() {
+	log.Info("Application started without a system tray")
+
+	if err := a.listenHotkey(); err != nil {
+		log.Errorf("Error registering global hotkey: %v", err)
+		log.Warn("Continuing without the global hotkey")
+	}
+	a.listenAccelerators()
+
+	if err := a.startWatching(); err != nil {
+		log.Fatalf("Error fetching value of 'Hidden' during startup: %v", err)
+	}
+	a.logStartupDiagnostics()
+	a.prepareRestore()
+	a.applyStartupState()
+	if flag.IdleExit > 0 {
+		a.watchIdle(flag.IdleExit)
+	}
+	a.Lib.WatchForegroundFolders()
+	a.showStatusLine()
+	if flag.Indicator {
+		a.showIndicator()
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	for {
+		select {
+		case sig := <-quit:
+			log.Infof("Received %s signal", sig)
+			a.onExit()
+			return
+
+		case <-a.quit:
+			log.Info("Quit requested")
+			a.onExit()
+			return
+
+		case err := <-a.ErrCh:
+			log.Error(err)
+		}
+	}
+}
+
+// watchIdle starts a goroutine that quits the application (see requestQuit) once no toggle occurred for d
+// (--idle-exit). Every change of the value stored as "status_hidden" restarts the countdown: toggles from any source
+// (e.g., the hotkey, the tray menu, or the HTTP control server), but also changes made by other tools and picked up
+// by the registry watcher. Storing the same value again (e.g., when reconciling, see WatchReconcile) does not.
+// The goroutine returns when the application stops.
+//
+// Parameters:
+//
+//	d - How long the application may stay idle.
+func (a *Application) watchIdle(d time.Duration) {
+	changes, cancel := state.Subscribe[uint64]("status_hidden")
+	goSafe(a.Logger, "idle exit", 0, func() {
+		defer cancel()
+
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		last, _ := state.Get[uint64]("status_hidden")
+		for {
+			select {
+			case value, ok := <-changes:
+				if !ok {
+					return
+				}
+				if value == last {
+					continue
+				}
+				last = value
+				timer.Reset(d)
+			case <-timer.C:
+				a.Logger.Infof("Quitting after %s without a toggle", d)
+				a.requestQuit()
+				return
+			case <-a.done:
+				return
+			}
+		}
+	})
+}
+
+// watchRegistry starts the registry watcher (see WatchRegistryKey), unless --no-watch is set, in which case the state
+// is only updated by the application's own changes and by Resync.
+func (a *Application) watchRegistry() {
+	if a.Config.NoWatch {
+		log.Info("Not watching the registry (--no-watch); changes made by other tools are not picked up")
+		return
+	}
+	a.Lib.WatchRegistryKey()
+}
+
+// startWatching stores the current value of "Hidden" in the state and starts the registry watcher
+// (see watchRegistry), along with the reconciliation loop if --reconcile-interval is set.
+// Returns an error if the value cannot be read, in which case nothing is started.
+func (a *Application) startWatching() error {
+	_, value, err := a.Lib.GetKeyValuePair(true)
+	if err != nil {
+		return err
+	}
+	state.Set("status_hidden", value)
+
+	a.watchRegistry()
+	if flag.ReconcileInterval > 0 {
+		a.Lib.WatchReconcile(flag.ReconcileInterval)
+	}
+
+	return nil
+}
+
+// listenHotkey registers the global hotkey for toggling hidden files and toggles the setting whenever it is pressed
+// (see bindHotkey), until regrabHotkey asks for it to be registered again. The label of the hotkey is stored as
+// "hotkey_label" in the state, and whether it is registered as "hotkey_registered". With --read-only, no hotkey is
+// registered. Returns an error if the hotkey could not be registered.
+func (a *Application) listenHotkey() error {
+	if a.Config.ReadOnly {
+		log.Info("Not registering the global hotkey (--read-only)")
+		return nil
+	}
+
+	state.Set("hotkey_label", hotkeyLabel(toggleMods, toggleKey))
+	err := a.bindHotkey(toggleMods, toggleKey, func() { a.Lib.ToggleHidden(sourceHotkey) }, a.regrab)
+	state.Set("hotkey_registered", err == nil)
+	if err != nil {
+		return err
+	}
+
+	a.hotkeyBound = true
+	return nil
+}
+
+// regrabHotkey unregisters the global hotkey for toggling hidden files and registers it again, e.g., when another
+// application took it over after startup so that pressing it no longer toggles anything, or registers it if that
+// failed at startup (see listenHotkey). The result is stored as "hotkey_registered" in the state and reflected in the
+// tooltip. Returns an error if the hotkey could not be registered.
+func (a *Application) regrabHotkey() error {
+	if !a.hotkeyBound {
+		err := a.listenHotkey()
+		a.Lib.RefreshSystray()
+		return err
+	}
+
+	reply := make(chan error, 1)
+	select {
+	case a.regrab <- reply:
+	case <-a.done:
+		return errors.New("application is stopping")
+	}
+
+	var err error
+	select {
+	case err = <-reply:
+	case <-a.done:
+		return errors.New("application is stopping")
+	}
+	state.Set("hotkey_registered", err == nil)
+	a.Lib.RefreshSystray()
+
+	return err
+}
+
+// listenAccelerators binds the accelerators enabled with --accelerators (see bindHotkey): its modifiers along with
+// quitKey quit the application (asking first with --confirm-quit), and along with aboutKey show the About dialog.
+// An accelerator that cannot be registered (e.g., because another application uses it) is skipped with a warning.
+func (a *Application) listenAccelerators() {
+	if flag.Accelerators == "" {
+		return
+	}
+	mods, err := parseModifiers(flag.Accelerators)
+	if err != nil {
+		log.Warnf("Not binding accelerators: %v", err)
+		return
+	}
+
+	accelerators := []struct {
+		key    hotkey.Key
+		action func()
+	}{
+		{quitKey, func() {
+			if a.confirmQuit() {
+				a.requestQuit()
+			}
+		}},
+		{aboutKey, func() {
+			msgbox("About", a.aboutText(), windows.MB_APPLMODAL|windows.MB_SETFOREGROUND, -1)
+		}},
+	}
+	for _, acc := range accelerators {
+		if err := a.bindHotkey(mods, acc.key, acc.action, nil); err != nil {
+			log.Warnf("Could not register accelerator %s: %v", hotkeyLabel(mods, acc.key), err)
+		}
+	}
+}
+
+// bindHotkey registers a global hotkey (see registerHotkey) and starts a goroutine that calls action whenever it is
+// pressed, until the application is stopped, at which point the hotkey is unregistered; onExit waits for that (see
+// waitWorkers). For every request received from regrab, the goroutine unregisters the hotkey, registers it again,
+// and replies with the result. Returns an error if the hotkey could not be registered.
+//
+// Parameters:
+//
+//	mods   - The modifiers of the hotkey.
+//	key    - The key of the hotkey.
+//	action - Called whenever the hotkey is pressed.
+//	regrab - Receives requests to register the hotkey again, or nil if it is never re-registered.
+func (a *Application) bindHotkey(mods []hotkey.Modifier, key hotkey.Key, action func(), regrab <-chan chan error) error {
+	hk := hotkey.New(mods, key)
+	if err := registerHotkey(hk); err != nil {
+		return err
+	}
+
+	label := hotkeyLabel(mods, key)
+	goTracked(&a.wg, a.Logger, "hotkey listener for "+label, watcherRestarts, func() {
+		for {
+			select {
+			case <-hk.Keydown():
+				log.Debugf("Hotkey %s activated", label)
+				action()
+			case reply := <-regrab:
+				// fails if the hotkey is not registered, e.g., because registering it again failed before
+				_ = hk.Unregister()
+				reply <- registerHotkey(hk)
+			case <-a.done:
+				_ = hk.Unregister()
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// runTemporary shows hidden files for the configured duration without starting the system tray,
+// then blocks until the setting has been reverted. Errors are reported to stderr and via a message box.
+func (a *Application) runTemporary() {
+	reverted, err := a.Lib.ShowTemporarily(flag.TemporaryDuration)
+	if err != nil {
+		msg := fmt.Sprintf("Error showing hidden files temporarily: %v", err)
+		log.Error(msg)
+		msgbox("Error", msg, windows.MB_OK|windows.MB_ICONERROR, ExitFatal)
+		select {} // msgbox exits once dismissed
+	}
+	if reverted != nil {
+		<-reverted
+	}
+	flushLog()
+}
+
+// onReady initializes the application once it is ready to start.
+// It sets up logging, registers a global hotkey for toggling hidden files,
+// initializes the systray menu items listed with --menu (see menuLayout), toggles on double-clicks of the tray icon
+// unless --no-double-click or --read-only is set (see hookTrayClicks), and starts watching
+// for registry changes, optionally backed by a periodic reconciliation loop.
+// The function enters a loop to handle menu item clicks and application errors,
+// responding to user interactions and system events, until Quit is clicked or onExit stops the application.
+func (a *Application) onReady() {
+	log.Info("Application started")
+	state.Set("tray_ready", true)
+
+	if err := a.listenHotkey(); err != nil {
+		msg := fmt.Sprintf("Error registering global hotkey: %v", err)
+		log.Error(msg)
+		if !confirm("Hotkey Unavailable", msg+"\n\nContinue without the hotkey?", windows.MB_ICONWARNING) {
+			os.Exit(ExitFatal)
+		}
+		log.Warn("Continuing without the global hotkey")
+	}
+	a.listenAccelerators()
+
+	_, value, err := a.Lib.GetKeyValuePair(true)
+	if err != nil {
+		msg := fmt.Sprintf("Error fetching value of 'Hidden' during startup: %v", err)
+		log.Fatal(msg)
+		msgbox("Fatal Error", msg, windows.MB_OK|windows.MB_ICONERROR, ExitFatal)
+	}
+	state.Set("status_hidden", value)
+	a.logStartupDiagnostics()
+	a.prepareRestore()
+	a.applyStartupState()
+
+	var mToggle, mTemporary, mUndo, mRedo, mCancelTemporary, mOpenFolder, mResync, mRegrabHotkey, mSeparateProcess,
+		mTopAbout, mTopReportBug, mTopQuit *systray.MenuItem
+	a.menu = menuLayout(flag.Menu)
+	for _, item := range a.menu {
+		switch item {
+		case menuToggle:
+			mToggle = systray.AddMenuItem("", "")
+			state.Set("menu_toggle", mToggle)
+		case menuTemporary:
+			mTemporary = systray.AddMenuItem("Show for "+flag.TemporaryDuration.String(), "")
+			state.Set("menu_temporary", mTemporary)
+		case menuUndo:
+			mUndo = systray.AddMenuItem("Undo last toggle", "Revert the last toggle")
+			state.Set("menu_undo", mUndo)
+		case menuRedo:
+			mRedo = systray.AddMenuItem("Redo toggle", "Toggle again after undoing")
+			state.Set("menu_redo", mRedo)
+		case menuCancelTemporary:
+			mCancelTemporary = systray.AddMenuItem("Cancel auto-hide", "Keep hidden files visible")
+			mCancelTemporary.Hide()
+			state.Set("menu_cancelTemporary", mCancelTemporary)
+		case menuSeparator:
+			systray.AddSeparator()
+		case menuAdvanced:
+			mTopAdvanced := systray.AddMenuItem("Advanced", "")
+			mOpenFolder = mTopAdvanced.AddSubMenuItem("Open containing folder", "Open the folder containing "+a.Meta.Name)
+			mResync = mTopAdvanced.AddSubMenuItem("Resync", "Re-read the hidden files setting and refresh all windows")
+			if !a.Config.ReadOnly {
+				mRegrabHotkey = mTopAdvanced.AddSubMenuItem("Re-register hotkey",
+					"Register "+hotkeyLabel(toggleMods, toggleKey)+" again if it stopped working")
+			}
+			separate, _ := a.Lib.GetValue("SeparateProcess")
+			state.Set("status_separateProcess", separate)
+			mSeparateProcess = mTopAdvanced.AddSubMenuItemCheckbox("Launch folder windows in a separate process",
+				"New folder windows only; restarting Explorer may be required", separate != 0)
+			state.Set("menu_separateProcess", mSeparateProcess)
+		case menuAbout:
+			mTopAbout = systray.AddMenuItem("About", "")
+		case menuReportBug:
+			mTopReportBug = systray.AddMenuItem("Report bug", "")
+		case menuQuit:
+			mTopQuit = systray.AddMenuItem("Quit", "")
+		}
+	}
+
+	if a.Config.ReadOnly {
+		// the items stay visible, but greyed out, so that it is clear why the state cannot be changed
+		for _, item := range []*systray.MenuItem{mToggle, mTemporary, mUndo, mRedo, mCancelTemporary} {
+			if item != nil {
+				item.Disable()
+			}
+		}
+	}
+
+	var trayDoubleClicked <-chan struct{}
+	if !flag.NoDoubleClick && !a.Config.ReadOnly {
+		if trayDoubleClicked, err = hookTrayClicks(); err != nil {
+			log.Warnf("Could not handle double-clicks of the tray icon: %v", err)
+		}
+	}
+
+	a.Lib.RefreshSystray()
+	a.watchRegistry()
+	if flag.ReconcileInterval > 0 {
+		a.Lib.WatchReconcile(flag.ReconcileInterval)
+	}
+	if flag.IdleExit > 0 {
+		a.watchIdle(flag.IdleExit)
+	}
+	a.Lib.WatchForegroundFolders()
+	a.showStatusLine()
+	if flag.Indicator {
+		a.showIndicator()
+	}
+	a.welcome()
+
+	for {
+		select {
+		case <-clicked(mToggle):
+			log.Debug("*Clicked Toggle*")
+			a.Lib.ToggleHidden(sourceMenu)
+
+		case <-trayDoubleClicked:
+			log.Debug("*Double-clicked tray icon*")
+			a.Lib.ToggleHidden(sourceTray)
+
+		case <-clicked(mTemporary):
+			log.Debug("*Clicked Show temporarily*")
+			if _, err := a.Lib.ShowTemporarily(flag.TemporaryDuration); err != nil {
+				log.Error(err)
+			}
+			a.Lib.RefreshSystray()
+
+		case <-clicked(mUndo):
+			log.Debug("*Clicked Undo last toggle*")
+			if err := a.Lib.UndoToggle(); err != nil {
+				log.Warnf("Could not undo toggle: %v", err)
+			}
+
+		case <-clicked(mRedo):
+			log.Debug("*Clicked Redo toggle*")
+			if err := a.Lib.RedoToggle(); err != nil {
+				log.Warnf("Could not redo toggle: %v", err)
+			}
+
+		case <-clicked(mCancelTemporary):
+			log.Debug("*Clicked Cancel auto-hide*")
+			if state.CancelTimer("timer_temporary") {
+				log.Info("Cancelled pending revert of temporarily shown hidden files")
+			}
+			a.Lib.RefreshSystray()
+
+		case <-clicked(mOpenFolder):
+			log.Debug("*Clicked Open containing folder*")
+			openExecutableDir()
+
+		case <-clicked(mResync):
+			log.Debug("*Clicked Resync*")
+			if err := a.Lib.Resync(); err != nil {
+				log.Errorf("Could not resync: %v", err)
+			}
+
+		case <-clicked(mRegrabHotkey):
+			log.Debug("*Clicked Re-register hotkey*")
+			label := hotkeyLabel(toggleMods, toggleKey)
+			if err := a.regrabHotkey(); err != nil {
+				msg := fmt.Sprintf("Could not register the global hotkey %s: %v", label, err)
+				log.Error(msg)
+				msgbox("Hotkey Unavailable", msg, windows.MB_OK|windows.MB_ICONWARNING, -1)
+			} else {
+				log.Infof("Registered the global hotkey %s again", label)
+			}
+
+		case <-clicked(mSeparateProcess):
+			log.Debug("*Clicked Launch folder windows in a separate process*")
+			if err := a.Lib.ToggleSeparateProcess(); err != nil {
+				log.Errorf("Could not toggle 'SeparateProcess': %v", err)
+			}
+
+		case <-clicked(mTopAbout):
+			log.Debug("*Clicked About*")
+			msgbox("About", a.aboutText(), windows.MB_APPLMODAL|windows.MB_SETFOREGROUND, -1)
+
+		case <-clicked(mTopReportBug):
+			log.Debug("*Clicked Report bug*")
+			if err := a.Lib.CopyToClipboard(a.summary()); err != nil {
+				log.Warnf("Could not copy diagnostics to clipboard: %v", err)
+			} else {
+				log.Info("Copied diagnostics to clipboard for the bug report")
+			}
+			if err := openUrl(a.Meta.ReportURL); err != nil {
+				msg := fmt.Sprintf("Error opening the bug report page: %v", err)
+				log.Error(msg)
+				msgbox("Error", msg, windows.MB_OK|windows.MB_ICONERROR, -1)
+			}
+
+		case <-clicked(mTopQuit):
+			log.Debug("*Clicked Quit*")
+			if !a.confirmQuit() {
+				continue
+			}
+			systray.Quit()
+			return
+
+		case <-a.done:
+			return
+
+		case err := <-a.ErrCh:
+			log.Error(err)
+		}
+	}
+}
+
+// onExit handles cleanup operations when the application is stopping.
+// It logs the application stop event, reverts any temporarily shown hidden files,
+// restores the value of "Hidden" from startup if --restore-on-exit is set,
+// clears the transient application state while persisting the rest, and if a console was spawned,
+// prints a countdown before exiting.
+func (a *Application) onExit() {
+	log.Info("Application stopped")
+	a.stop()
+	a.waitWorkers(shutdownTimeout)
+	if value, ok := state.Get[uint64]("timer_temporary"); ok {
+		log.Info("Reverting temporarily shown hidden files before exit")
+		if err := a.setHidden(value, exitSource()); err != nil {
+			log.Error(err)
+		}
+	}
+	if value, ok := state.Get[uint64]("folder_rule"); ok && value == statusHidden {
+		log.Info("Hiding hidden files shown for a folder before exit")
+		if err := a.setHidden(value, exitSource()); err != nil {
+			log.Error(err)
+		}
+	}
+	if err := a.restoreOriginal(); err != nil {
+		log.Error(err)
+	}
+	state.ClearExcept(persistedKeys...)
+	saveState(a.Meta.Name)
+	flushLog()
+	if c, ok := a.Audit.(io.Closer); ok {
+		_ = c.Close()
+	}
+
+	if consoleMode() == consoleSpawn {
+		fmt.Println("This console will exit in")
+		for i := 3; i > 0; i-- {
+			fmt.Printf("%d...\n", i)
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
+
+// confirmQuit asks whether to quit if --confirm-quit is set, and reports whether the application should quit.
+func (a *Application) confirmQuit() bool {
+	if !flag.ConfirmQuit ||
+		confirm("Quit", "Quit "+a.Meta.Name+"?\n\nThe hotkey stops working until it is started again.", windows.MB_ICONQUESTION) {
+		return true
+	}
+
+	log.Debug("Quit cancelled")
+	return false
+}
+
+// requestQuit quits the application as if Quit had been clicked in the tray menu, or, without a system tray
+// (--no-tray), as if it had been interrupted.
+func (a *Application) requestQuit() {
+	if a.Config.NoTray {
+		select {
+		case a.quit <- struct{}{}:
+		default:
+		}
+		return
+	}
+	systray.Quit()
+}
+
+// stop signals the goroutines started by the application (e.g., the menu loop of onReady and the hotkey listener)
+// to return. It is safe to call more than once.
+func (a *Application) stop() {
+	a.doneOnce.Do(func() { close(a.done) })
+}
+
+// stopping reports whether stop was called.
+func (a *Application) stopping() bool {
+	select {
+	case <-a.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitWorkers waits for the goroutines tracked in wg (e.g., the registry watcher and the wait for File Explorer) to
+// return once stop signalled them, so that their hooks and handles are released before exiting. It gives up after
+// timeout, logging a warning, so that a stuck goroutine cannot prevent the application from exiting.
+//
+// Parameters:
+//
+//	timeout - How long to wait at most.
+func (a *Application) waitWorkers(timeout time.Duration) {
+	finished := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		log.Debug("Background goroutines stopped")
+	case <-time.After(timeout):
+		log.Warnf("Background goroutines did not stop within %s", timeout)
+	}
+}
+
+// aboutText renders the About dialog text from the first template that is set among --about-template,
+// Meta.About (e.g., embedded at build time), and defaultAboutTemplate. If the template cannot be rendered,
+// a warning is logged and the default template is used instead.
+func (a *Application) aboutText() string {
+	data := aboutData{
+		Name:    a.Meta.Name,
+		Version: a.Meta.Version,
+		License: a.Meta.License,
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+	}
+
+	text := defaultAboutTemplate
+	if flag.AboutTemplate != "" {
+		text = flag.AboutTemplate
+	} else if a.Meta.About != "" {
+		text = a.Meta.About
+	}
+
+	var b strings.Builder
+	tmpl, err := template.New("about").Parse(text)
+	if err == nil {
+		err = tmpl.Execute(&b, data)
+	}
+	if err != nil {
+		log.Warnf("Could not render About template: %v", err)
+		b.Reset()
+		_ = template.Must(template.New("about").Parse(defaultAboutTemplate)).Execute(&b, data)
+	}
+
+	return b.String()
+}
+
+// summary returns a short, human-readable description of the application and its environment
+// (version, platform, Windows build, hidden files status, registry watcher status, and the size of the state store
+// and the heap, which help spotting leaks in long-running sessions) suitable for pasting into a bug report.
+func (a *Application) summary() string {
+	v := windows.RtlGetVersion()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	hidden, _ := state.Get[uint64]("status_hidden")
+	watcher := "running"
+	if !a.Lib.WatcherRunning() {
+		watcher = "stopped"
+	}
+	if msg := a.Lib.WatcherError(); msg != "" {
+		watcher += " (last error: " + msg + ")"
+	}
+
+	return fmt.Sprintf("%s %s (%s-%s)\nWindows %d.%d.%d\nHidden: %d\nWatcher: %s\n"+
+		"State: %d entries, %d timers\nHeap: %d KiB\n",
+		a.Meta.Name, strings.TrimSpace(a.Meta.Version), runtime.GOOS, runtime.GOARCH,
+		v.MajorVersion, v.MinorVersion, v.BuildNumber, hidden, watcher,
+		state.Len(), len(state.ActiveTimers()), mem.HeapAlloc/1024)
+}
+
+// logStartupDiagnostics logs a single DEBUG block describing the environment the application runs in:
+// the resolved flags, the environment variables that were read (with sensitive values omitted), the Windows version,
+// whether the process is elevated, the executable path, and the initial value of "Hidden". It gives every verbose
+// log a consistent header to speed up diagnosing reported issues. Nothing is done unless DEBUG logging is enabled.
+func (a *Application) logStartupDiagnostics() {
+	if !log.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Startup diagnostics for %s %s\n", a.Meta.Name, strings.TrimSpace(a.Meta.Version))
+
+	b.WriteString("Flags:\n")
+	pflag.VisitAll(func(f *pflag.Flag) {
+		fmt.Fprintf(&b, "  --%s=%s", f.Name, f.Value)
+		if f.Changed {
+			b.WriteString(" (set)")
+		}
+		b.WriteString("\n")
+	})
+
+	b.WriteString("Environment:\n")
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := env[key]
+		if isSensitiveEnv(key) {
+			value = "<omitted>"
+		}
+		fmt.Fprintf(&b, "  %s=%s\n", key, value)
+	}
+
+	v := windows.RtlGetVersion()
+	fmt.Fprintf(&b, "Windows: %d.%d.%d (%s-%s)\n", v.MajorVersion, v.MinorVersion, v.BuildNumber, runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Elevated: %t\n", windows.GetCurrentProcessToken().IsElevated())
+	if exe, err := os.Executable(); err == nil {
+		fmt.Fprintf(&b, "Executable: %s\n", exe)
+	} else {
+		fmt.Fprintf(&b, "Executable: unknown (%v)\n", err)
+	}
+	if hidden, ok := state.Get[uint64]("status_hidden"); ok {
+		fmt.Fprintf(&b, "Hidden: %d", hidden)
+	} else {
+		b.WriteString("Hidden: unknown")
+	}
+
+	log.Debug(b.String())
+}
+
+// isSensitiveEnv reports whether the value of the named environment variable may contain a secret
+// and must therefore be omitted from logs.
+func isSensitiveEnv(key string) bool {
+	key = strings.ToUpper(key)
+	for _, word := range []string{"TOKEN", "SECRET", "PASSWORD", "CREDENTIAL", "KEY"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// welcome shows a one-time message explaining the hotkey and tray menu on the first run of the application.
+// Once shown, the "first_run_done" marker is persisted so the message never appears again.
+// The message is skipped entirely when --no-welcome is set. The systray library does not expose
+// balloon notifications, so a non-blocking message box is used instead.
+func (a *Application) welcome() {
+	if done, _ := state.Get[bool]("first_run_done"); done || flag.NoWelcome {
+		return
+	}
+
+	log.Debug("First run detected; showing welcome message")
+	text := "Press " + hotkeyLabel(toggleMods, toggleKey) + " at any time to toggle the visibility of hidden files, " +
+		"or use the tray icon's menu."
+	if a.Config.ReadOnly {
+		text = "Its tray icon shows whether hidden files are visible. Changing it has been disabled."
+	}
+	msgbox("Welcome to "+a.Meta.Name, a.Meta.Name+" is now running in the system tray.\n\n"+text,
+		windows.MB_OK|windows.MB_ICONINFORMATION|windows.MB_SETFOREGROUND, -1)
+
+	state.Set("first_run_done", true)
+	saveState(a.Meta.Name)
+}
+
+// statePath returns the location of the file used to persist state between runs.
+func statePath(appName string) string {
+	return filepath.Join(configDir(appName), "state.json")
+}
+
+// consoleMode returns the console mode selected with --console. When unset, it defaults to consoleAttach
+// if --attach-pid is set, and consoleNone unless --verbose is set. With --verbose, it defaults to consoleAttach
+// if the parent console was attached during init (e.g., when run from a terminal), so that output goes to that
+// console, and to consoleSpawn otherwise (e.g., when started from a shortcut).
+func consoleMode() string {
+	if flag.Console != "" {
+		return flag.Console
+	}
+	if flag.AttachPid != 0 {
+		return consoleAttach
+	}
+	if flag.Verbose {
+		if con.Bound() {
+			return consoleAttach
+		}
+		return consoleSpawn
+	}
+
+	return consoleNone
+}
+
+// checkProcess verifies that a process with the given PID exists and can be queried.
+// Returns a descriptive error if it does not.
+func checkProcess(pid uint32) error {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return fmt.Errorf("process %d not found: %v", pid, err)
+	}
+
+	return windows.CloseHandle(handle)
+}
+
+// flushLog flushes and stops the buffered log sink, if --log-buffer enabled one.
+func flushLog() {
+	if logBuf != nil {
+		_ = logBuf.Close()
+	}
+}
+
+// saveState persists the entries listed in persistedKeys, logging a warning if it fails.
+func saveState(appName string) {
+	if err := state.Save(statePath(appName), persistedKeys...); err != nil {
+		log.Warnf("Could not persist state: %v", err)
+	}
+}
+
+// registerHotkey registers the given global hotkey, retrying with an exponential backoff when it fails.
+// Another process may briefly hold the same hotkey (e.g., while startup applications load after login),
+// so a failed attempt is not treated as final until hotkeyAttempts have been made.
+// Returns the error from the last attempt if the hotkey could not be registered.
+func registerHotkey(hk *hotkey.Hotkey) (err error) {
+	backoff := hotkeyBackoff
+	for attempt := 1; attempt <= hotkeyAttempts; attempt++ {
+		if err = hk.Register(); err == nil {
+			return nil
+		}
+		if attempt < hotkeyAttempts {
+			log.Debugf("Could not register global hotkey (attempt %d/%d): %v; retrying in %s",
+				attempt, hotkeyAttempts, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return err
+}
+
+// confirm displays a Windows message box with "Yes" and "No" buttons and blocks until it is closed.
+// Unlike msgbox, it runs synchronously so the caller can act on the answer.
+// Returns true if the user selected "Yes".
+//
+// Parameters:
+//
+//	title   - The title of the message box window.
+//	text    - The question to display in the box.
+//	boxtype - Additional message box flags (e.g., MB_ICONWARNING).
+func confirm(title string, text string, boxtype uint32) bool {
+	ret, _ := windows.MessageBox(
+		0,
+		windows.StringToUTF16Ptr(text),
+		windows.StringToUTF16Ptr(title),
+		windows.MB_APPLMODAL|windows.MB_SETFOREGROUND|windows.MB_YESNO|boxtype,
+	)
+
+	return ret == idYes
+}
+
+// msgbox displays a Windows message box with the specified title, text, and box type.
+// It ensures that only one message box with the same title and text is shown at a time by tracking state
+// under a hash of both, so different messages sharing a title (e.g., "Error") never suppress each other.
+// The function runs the message box in a separate goroutine. If exitCode is non-negative,
+// the application will exit with the provided exit code after the message box is closed.
+//
+// Parameters:
+//
+//	title    - The title of the message box window.
+//	text:    - The message to display in the box.
+//	boxtype  - The type of message box (e.g., MB_OK, MB_ICONERROR).
+//	exitCode - If >= 0, exits the application with this code after closing the box.
+func msgbox(title string, text string, boxtype uint32, exitCode int) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(title + "\x00" + text))
+	stateLabel := fmt.Sprintf("msgbox_%016x", h.Sum64())
+
+	var shown bool
+	state.Update(stateLabel, func(open bool, _ bool) bool {
+		shown = !open
+		return true
+	})
+	if !shown {
+		return
+	}
+
+	go func() {
+		_, _ = windows.MessageBox(
+			0,
+			windows.StringToUTF16Ptr(text),
+			windows.StringToUTF16Ptr(title),
+			windows.MB_APPLMODAL|boxtype,
+		)
+		state.Delete(stateLabel)
+
+		if exitCode >= 0 {
+			os.Exit(exitCode)
+		}
+	}()
+}
+
+// runCommand starts the named program with the given arguments without waiting for it to finish.
+// The process is reaped in the background once it exits. Returns an error if the program cannot be started.
+func runCommand(name string, args ...string) error {
+	log.Debugf("Running %q with arguments %q", name, args)
+	return startCommand(exec.Command(name, args...), nil)
+}
+
+// startCommand starts cmd without waiting for it to finish. The process is reaped in the background once it exits,
+// after which onExit (if non-nil) is called with the result of cmd.Wait. Returns an error if cmd cannot be started,
+// in which case onExit is not called.
+func startCommand(cmd *exec.Cmd, onExit func(err error)) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go func() {
+		err := cmd.Wait()
+		if onExit != nil {
+			onExit(err)
+		}
+	}()
+	return nil
+}
+
+// openExecutableDir opens the folder containing the running executable in File Explorer.
+// It logs and displays errors when encountered; otherwise, no error means success.
+func openExecutableDir() {
+	exe, err := os.Executable()
+	if err != nil {
+		msg := fmt.Sprintf("Error locating the executable: %v", err)
+		log.Error(msg)
+		msgbox("Error", msg, windows.MB_OK|windows.MB_ICONERROR, -1)
+		return
+	}
+
+	dir := filepath.Dir(exe)
+	if err = runCommand(filepath.Join(env["SystemRoot"], "explorer.exe"), dir); err != nil {
+		msg := fmt.Sprintf("Error opening %q: %v", dir, err)
+		log.Error(msg)
+		msgbox("Error", msg, windows.MB_OK|windows.MB_ICONERROR, -1)
+	}
+}
+
+// openUrl launches the provided url in the default browser. Since the url is handed to rundll32 (whose command line
+// is not parsed like that of other programs), only absolute http and https urls are accepted, and any spaces,
+// quotes, control characters, or non-ASCII bytes left in it are percent-encoded. Returns an error if the url is
+// invalid or cannot be launched.
+func openUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("refusing to launch url with scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("refusing to launch url without host: %q", rawUrl)
+	}
+
+	escaped := escapeUrlArg(u.String())
+	log.Debugf("Launching %q", escaped)
+	if err = runCommand("rundll32", "url.dll,FileProtocolHandler", escaped); err != nil {
+		return fmt.Errorf("failed to launch %q: %v", escaped, err)
+	}
+
+	return nil
+}
+
+// escapeUrlArg percent-encodes the bytes of s that url.URL.String leaves as they are in some parts of a url (e.g.,
+// the query) but that must not reach a command line unescaped: spaces, quotes, control characters, and non-ASCII bytes.
+func escapeUrlArg(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == '"' || c >= 0x7f {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// setLogger configures the global logger instance (which New assigns to Application.Logger).
+// It sets the log formatter, log level, and output destinations based on the provided logName and global flag values.
+// If a log file is specified, it validates the file path and configures log rotation using lumberjack.
+// The logger output is set to both stderr and the log file (if valid). When --log-buffer is set, the output
+// is batched through a logBuffer that flushes on that interval and immediately for entries at ERROR or above.
+// Depending on the console mode, it keeps the parent console attached during init, spawns a new
+// console window for logging output, or detaches from any console. Console output is colored as selected with
+// --log-color (see logColors), while the log file is always written without colors.
+// Any errors encountered during setup are reported to stderr and, if applicable, via a message box.
+func setLogger(logName string) {
+	formatter := &LogFormatter{
+		TextFormatter: logrus.TextFormatter{FullTimestamp: true, TimestampFormat: flag.LogTimestamp},
+		UTC:           flag.LogUTC,
+	}
+	log.SetFormatter(formatter)
+
+	if lvl, err := logrus.ParseLevel(flag.LogLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log level: %v\n", err)
+	} else {
+		log.SetLevel(lvl)
+	}
+
+	writers := []io.Writer{}
+	if flag.LogFile != "" {
+		logF := flag.LogFile
+		var logD, logN string
+
+		info, err := os.Stat(logF)
+		if err == nil && info.IsDir() {
+			logD = logF
+			logN = logName
+		} else {
+			logD = filepath.Dir(logF)
+			logN = filepath.Base(logF)
+		}
+
+		logF = filepath.Join(logD, logN)
+		logT := logF + ".TMP"
+		valid := true
+
+		f, err := os.Create(logT)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid log file: %v\n", err)
+			valid = false
+		} else {
+			if err = f.Close(); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to close %q: %v\n", logT, err)
+				valid = false
+			}
+			if err = os.Remove(logT); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to remove %q: %v\n", logT, err)
+				valid = false
+			}
+		}
+
+		if valid {
+			writers = append(writers, &ansiStripper{w: &lumberjack.Logger{
+				Filename:   logF,
+				MaxBackups: 4,
+				MaxAge:     28,
+			}})
+			state.Set("log_file", logF)
+		}
+	}
+
+	switch consoleMode() {
+	case consoleAttach:
+		// keep logging to the parent console attached during init, unless another process was requested
+		if flag.AttachPid != 0 {
+			_ = con.Detach()
+			if err := con.Attach(flag.AttachPid); err != nil {
+				msg := fmt.Sprintf("Failed to attach to the console of process %d: %v", flag.AttachPid, err)
+				fmt.Fprintln(os.Stderr, msg)
+				msgbox("Error", msg, windows.MB_OK|windows.MB_ICONERROR, ExitFatal)
+			}
+		}
+	case consoleSpawn:
+		_ = con.Detach()
+		if err := con.Spawn(); err != nil {
+			msg := fmt.Sprintf("Failed to spawn: %v", err)
+			fmt.Fprintln(os.Stderr, msg)
+			msgbox("Error", msg, windows.MB_OK|windows.MB_ICONERROR, ExitFatal)
+		}
+	default:
+		_ = con.Detach()
+	}
+
+	// colors are decided once the console is known; the file sink strips them again (see ansiStripper)
+	colors := logColors(os.Stderr)
+	formatter.ForceColors, formatter.DisableColors = colors, !colors
+
+	writers = append([]io.Writer{os.Stderr}, writers...)
+	mw := io.MultiWriter(writers...)
+	if flag.LogBuffer > 0 {
+		logBuf = newLogBuffer(mw, flag.LogBuffer)
+		log.SetFormatter(&flushingFormatter{Formatter: log.Formatter, buffer: logBuf})
+		log.SetOutput(logBuf)
+		return
+	}
+	log.SetOutput(mw)
+}
+
+func init() {
+	env = make(map[string]string)
+
+	for _, key := range []string{"DEBUG", "SHOWALLFILES_CLI_ARGS", "SystemRoot", "TMP"} {
+		if value, exists := os.LookupEnv(key); exists {
+			env[key] = value
+		}
+	}
+
+	debug = strings.EqualFold(env["DEBUG"], "true")
+	log = logrus.New()
+	con = console.New(debug)
+}
+
+// parseFlags registers the command-line flags and parses them. It is called by Run rather than at initialization, so
+// that a program embedding the package keeps its own command line (and its flags) to itself. With DEBUG=true, the
+// command line is replaced by the ";"-separated arguments in SHOWALLFILES_CLI_ARGS, if set.
+func parseFlags() {
+	if debug && env["SHOWALLFILES_CLI_ARGS"] != "" {
+		args := strings.Split(env["SHOWALLFILES_CLI_ARGS"], ";")
+		os.Args = append([]string{os.Args[0]}, args...)
+	}
+
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", filepath.Base(os.Args[0]))
+		pflag.PrintDefaults()
+	}
+	pflag.ErrHelp = errors.New("")
+	pflag.CommandLine.SortFlags = false
+	pflag.StringVar(&flag.AboutTemplate, "about-template", "", "Go text/template for the About dialog (fields: Name, Version, License, OS, Arch)")
+	pflag.StringVar(&flag.Accelerators, "accelerators", "", "Modifiers (e.g., Ctrl+Alt) that with Q quit and with A show About; disabled if empty")
+	pflag.Uint32Var(&flag.AttachPid, "attach-pid", 0, "Attaches output to the console of the process with this PID")
+	pflag.StringVar(&flag.AuditLog, "audit-log", "", "File path to append a JSON line to for every write of 'Hidden' (independent of --log-level)")
+	pflag.StringVar(&flag.Config, "config", "", `Configuration file (default "%AppData%\ShowAllFiles\config.json")`)
+	pflag.StringVar(&flag.PrintConfig, "print-config", "", "Prints the effective configuration and the source of each value as a table or json, and exits")
+	pflag.Lookup("print-config").NoOptDefVal = outputTable
+	pflag.StringVar(&flag.SetConfig, "set-config", "", `Stores a setting in the registry key HKCU\Software\ShowAllFiles, given as flag-name=value, and exits`)
+	pflag.StringVar(&flag.Output, "output", outputTable, "Output format of --status, --dump-windows, --print-config, and --export-settings to stdout: table|json")
+	pflag.BoolVar(&flag.ConfirmQuit, "confirm-quit", false, "Asks for confirmation before quitting from the tray menu")
+	pflag.StringVar(&flag.Console, "console", "", "Console for output: attach|spawn|none (default none; with --verbose, attach if run from a console, otherwise spawn)")
+	pflag.BoolVar(&flag.DumpWindows, "dump-windows", false, "Prints the candidate File Explorer windows and whether they are detected, and exits")
+	pflag.BoolVar(&flag.Status, "status", false, "Prints whether hidden files, file extensions, and protected operating system files are shown, and exits")
+	pflag.StringVar(&flag.ExportSettings, "export-settings", "", `Writes Explorer's advanced settings as JSON to a file (or "-" for stdout) and exits`)
+	pflag.Lookup("export-settings").NoOptDefVal = "-"
+	pflag.StringVar(&flag.ImportSettings, "import-settings", "", "Writes Explorer's advanced settings from a JSON file created by --export-settings and exits")
+	pflag.BoolVar(&flag.Refresh, "refresh", false, "Refreshes all open File Explorer windows and exits")
+	pflag.StringVar(&flag.SetDword, "set-dword", "", "Writes a DWORD value of Explorer's advanced settings, given as name=value, and exits")
+	pflag.StringVar(&flag.ToggleDword, "toggle-dword", "", "Flips a DWORD value of Explorer's advanced settings between 0 and 1 (Hidden between 1 and 2) and exits")
+	pflag.BoolVar(&flag.InstallService, "install-service", false, "Installs and starts a Windows service that watches the registry (requires administrator) and exits")
+	pflag.BoolVar(&flag.UninstallService, "uninstall-service", false, "Stops and removes the Windows service (requires administrator) and exits")
+	pflag.BoolVar(&flag.Force, "force", false, "Allows writing registry values that are not known to be safe")
+	pflag.StringVar(&flag.HTTP, "http", "", "Loopback address (e.g., 127.0.0.1:8080) to serve a JSON control API on")
+	pflag.DurationVar(&flag.IdleExit, "idle-exit", 0, "Quits after this long without a toggle (0 = off)")
+	pflag.BoolVar(&flag.Indicator, "indicator", false, "Shows an always-on-top window in the corner of the screen telling whether hidden files are shown")
+	pflag.StringVar(&flag.LogLevel, "log-level", "INFO", "Log level: DEBUG|INFO|WARN|ERROR|FATAL|PANIC")
+	pflag.StringVar(&flag.LogFile, "log", "", "File path to save log output")
+	pflag.StringVar(&flag.LogTimestamp, "log-timestamp", "", "Go time layout for log timestamps (e.g., \"2006-01-02T15:04:05.000Z07:00\"; default RFC 3339)")
+	pflag.BoolVar(&flag.LogUTC, "log-utc", false, "Writes log timestamps in UTC instead of local time")
+	pflag.DurationVar(&flag.LogBuffer, "log-buffer", 0, "Buffers log output and flushes it at this interval or on errors (0 = unbuffered)")
+	pflag.StringVar(&flag.LogColor, "log-color", colorAuto, "Colors console log output: auto|always|never (log files are never colored)")
+	pflag.StringSliceVar(&flag.Menu, "menu", nil, "Tray menu items in order: toggle|temporary|undo|redo|cancel-temporary|advanced|about|report-bug|separator|quit (repeatable; quit is always shown)")
+	pflag.BoolVar(&flag.NoDoubleClick, "no-double-click", false, "Opens the tray menu right away on a left click instead of toggling on a double-click of the tray icon")
+	pflag.BoolVar(&flag.NoRefresh, "no-refresh", false, "Changes registry values without refreshing File Explorer windows (see --refresh)")
+	pflag.StringSliceVar(&flag.NoRefreshFolders, "no-refresh-folder", nil, "Folder (with its subfolders) whose File Explorer tabs are not refreshed when toggling (repeatable)")
+	pflag.BoolVar(&flag.NoStatusLine, "no-status-line", false, "Does not print a status line to the console (with --verbose) whenever hidden files are shown or hidden")
+	pflag.BoolVar(&flag.NoTray, "no-tray", false, "Runs without a system tray, providing only the hotkey and registry watcher until stopped")
+	pflag.BoolVar(&flag.NoWatch, "no-watch", false, "Does not watch the registry, so changes made by other tools are only picked up by Resync")
+	pflag.BoolVar(&flag.NoWelcome, "no-welcome", false, "Never shows the first-run welcome message")
+	pflag.StringVar(&flag.OnToggle, "on-toggle", "", "Command to run after a successful toggle, given \"visible\" or \"hidden\" as its last argument")
+	pflag.DurationVar(&flag.PollInterval, "poll-interval", defaultPollInterval, "Interval to re-read the registry with --watch-mode=poll")
+	pflag.BoolVar(&flag.ReadOnly, "read-only", false, "Disables toggling (hotkey, tray menu, HTTP, and commands writing Hidden), only showing the status")
+	pflag.DurationVar(&flag.ReconcileInterval, "reconcile-interval", 0, "Interval to re-check the registry for missed changes (0 = off)")
+	pflag.StringSliceVar(&flag.RefreshClasses, "refresh-class", nil, "Window class of a third-party file manager to refresh with F5 (repeatable)")
+	pflag.BoolVar(&flag.RefreshForegroundOnly, "refresh-foreground-only", false, "Refreshes only the foreground File Explorer window after a change instead of all of them")
+	pflag.StringVar(&flag.RefreshMode, "refresh-mode", refreshMessage, "How File Explorer windows are refreshed: message|com")
+	pflag.BoolVar(&flag.RefreshUnverified, "refresh-unverified", false, "Also refreshes File Explorer windows whose process cannot be verified (e.g., an elevated Explorer)")
+	pflag.BoolVar(&flag.RestoreOnExit, "restore-on-exit", false, "Restores the visibility of hidden files from startup when exiting")
+	pflag.BoolVar(&flag.SelfTest, "selftest", false, "Checks that the registry and File Explorer windows can be accessed, prints a report, and exits")
+	pflag.DurationVar(&flag.SettleDelay, "settle-delay", defaultSettleDelay, "Time to let File Explorer pick up a change before refreshing its windows")
+	pflag.StringSliceVar(&flag.ShowFolders, "show-in-folder", nil, "Folder in which hidden files are shown while its window is in the foreground (repeatable)")
+	pflag.IntVar(&flag.Stress, "stress", 0, "Soak tests toggling and refreshing for this many iterations, reports leaks, and exits")
+	_ = pflag.CommandLine.MarkHidden("stress")
+	pflag.StringVar(&flag.StartupState, "startup-state", startupKeep, "Visibility of hidden files to enforce at startup: keep|show|hide")
+	pflag.BoolVar(&flag.Temporary, "temporary", false, "Shows hidden files, then hides them again after --temporary-duration and exits")
+	pflag.DurationVar(&flag.TemporaryDuration, "temporary-duration", 30*time.Second, "How long hidden files are shown temporarily")
+	pflag.StringVar(&flag.ToggleFeedback, "toggle-feedback", feedbackNone, "Confirmation of a toggle: none|sound|flash")
+	pflag.BoolVarP(&flag.Verbose, "verbose", "v", false, "Writes verbose output to the console it was run from, or allocates a new console")
+	pflag.BoolVar(&flag.Version, "version", false, "Prints version")
+	pflag.DurationVar(&flag.WatchDebounce, "watch-debounce", defaultWatchDebounce, "Time to wait for further toggles before writing the setting once (0 = write right away)")
+	pflag.StringVar(&flag.WatchMode, "watch-mode", watchEvent, "How registry changes are detected: event|poll")
+	pflag.Parse()
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// Sources of a toggle or another write of "Hidden", as recorded in the audit log.
+const (
+	sourceCLI     = "cli"
+	sourceExit    = "exit"
+	sourceHotkey  = "hotkey"
+	sourceHTTP    = "http"
+	sourceMenu    = "menu"
+	sourceRedo    = "redo"
+	sourceService = "service"
+	sourceTray    = "tray icon"
+	sourceUndo    = "undo"
+)
+
+// auditEntry is a single line of the audit log written with --audit-log.
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Old     uint64    `json:"old"`
+	New     uint64    `json:"new"`
+	Source  string    `json:"source"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// audit appends the given entry as a line of JSON to Application.Audit, if set.
+// The audit log is written independently of the Logger, so it is not affected by the log level.
+// Failures to write it are logged as errors.
+//
+// Parameters:
+//
+//	entry - The entry to append.
+func (a *Application) audit(entry auditEntry) {
+	if a.Audit == nil {
+		return
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		a.Logger.Errorf("Could not encode audit log entry: %v", err)
+		return
+	}
+
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+
+	if _, err = a.Audit.Write(append(b, '\n')); err != nil {
+		a.Logger.Errorf("Could not write audit log entry: %v", err)
+	}
+}
+
+// auditWrite appends an entry for a write of "Hidden" that is not a toggle (those are recorded by commitToggle) to
+// the audit log. Writes refused with errReadOnly are not recorded, since nothing was attempted.
+//
+// Parameters:
+//
+//	old    - The value of "Hidden" before the write.
+//	value  - The value written.
+//	source - What made the write (e.g., sourceCLI).
+//	err    - The error of the write, if it failed.
+func (a *Application) auditWrite(old, value uint64, source string, err error) {
+	if errors.Is(err, errReadOnly) {
+		return
+	}
+
+	entry := auditEntry{Time: time.Now(), Old: old, New: value, Source: source, Success: err == nil}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.audit(entry)
+}
+
+// setHidden writes value to "Hidden" through SetHidden and records the write in the audit log.
+//
+// Parameters:
+//
+//	value  - The hidden files status to write.
+//	source - What made the write, as recorded in the audit log.
+func (a *Application) setHidden(value uint64, source string) error {
+	old, _ := a.Lib.GetValue("Hidden")
+	err := a.Lib.SetHidden(value)
+	a.auditWrite(old, value, source, err)
+
+	return err
+}
+
+// writeValue writes the DWORD value name through SetValue for a command-line option (e.g., --set-dword), and
+// records the write in the audit log with sourceCLI if name is "Hidden".
+//
+// Parameters:
+//
+//	name  - The name of the registry value.
+//	value - The value to write.
+func (a *Application) writeValue(name string, value uint32) error {
+	if !strings.EqualFold(name, "Hidden") {
+		return a.Lib.SetValue(name, value)
+	}
+
+	old, _ := a.Lib.GetValue("Hidden")
+	err := a.Lib.SetValue(name, value)
+	a.auditWrite(old, uint64(value), sourceCLI, err)
+
+	return err
+}
+
+// exitSource returns the source recorded in the audit log for the writes made by onExit: sourceService when
+// running as a Windows service, and sourceExit otherwise.
+func exitSource() string {
+	if isService, _ := svc.IsWindowsService(); isService {
+		return sourceService
+	}
+
+	return sourceExit
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/kamaranl/winapi"
+	"golang.org/x/sys/windows"
+)
+
+// COM classes and interfaces used by enumShellWindows and shellBrowser.
+var (
+	clsidShellWindows = windows.GUID{Data1: 0x9BA05972, Data2: 0xF6A8, Data3: 0x11CF, Data4: [8]byte{0xA4, 0x42, 0x00, 0xA0, 0xC9, 0x0A, 0x8F, 0x39}}
+	iidIShellWindows  = windows.GUID{Data1: 0x85CB6900, Data2: 0x4D95, Data3: 0x11CF, Data4: [8]byte{0x96, 0x0C, 0x00, 0x80, 0xC7, 0xF4, 0xEE, 0x85}}
+	iidIEnumVARIANT   = windows.GUID{Data1: 0x00020404, Data2: 0x0000, Data3: 0x0000, Data4: [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}}
+	iidIWebBrowser2   = windows.GUID{Data1: 0xD30C1661, Data2: 0xCDAF, Data3: 0x11D0, Data4: [8]byte{0x8A, 0x3E, 0x00, 0xC0, 0x4F, 0xC9, 0xE2, 0x6E}}
+)
+
+// Indexes of the COM methods called on ShellWindows and its windows in the vtables of their interfaces.
+const (
+	methodQueryInterface = 0  // IUnknown::QueryInterface
+	methodRelease        = 2  // IUnknown::Release
+	methodEnumNext       = 3  // IEnumVARIANT::Next
+	methodNewEnum        = 9  // IShellWindows::_NewEnum
+	methodRefresh        = 12 // IWebBrowser::Refresh
+	methodLocationURL    = 30 // IWebBrowser::get_LocationURL
+	methodGetHWND        = 37 // IWebBrowserApp::get_HWND
+)
+
+// vtDispatch is the VARIANT type of an IDispatch pointer (VT_DISPATCH).
+const vtDispatch = 9
+
+// comObject is a COM interface pointer, whose first field points to the vtable of the interface.
+type comObject struct {
+	vtbl *[64]uintptr
+}
+
+// method returns the address of the method at index i of the vtable.
+func (o *comObject) method(i int) uintptr {
+	return o.vtbl[i]
+}
+
+// release releases the interface pointer, if it is not nil.
+func (o *comObject) release() {
+	if o != nil {
+		_, _, _ = syscall.SyscallN(o.method(methodRelease), uintptr(unsafe.Pointer(o)))
+	}
+}
+
+// variant mirrors the Win32 VARIANT structure, limited to the IDispatch pointer that IEnumVARIANT returns for
+// the windows of ShellWindows. Its size matches VARIANT on both 32-bit and 64-bit Windows.
+type variant struct {
+	vt   uint16
+	_    [3]uint16
+	disp *comObject
+	_    uintptr
+}
+
+// hresultError returns an error describing a failed HRESULT, or nil if hr indicates success.
+func hresultError(call string, hr uintptr) error {
+	if int32(hr) >= 0 {
+		return nil
+	}
+
+	return fmt.Errorf("failed call to %s: %v", call, syscall.Errno(uint32(hr)))
+}
+
+// refreshShellWindows refreshes the views of the File Explorer windows (and, on Windows 11, of each of their tabs)
+// by calling IWebBrowser2::Refresh on every window of the ShellWindows COM object (see enumShellWindows), as selected
+// with --refresh-mode=com. Tabs showing a folder listed with --no-refresh-folder are skipped. It returns the handles of
+// the windows that were refreshed or skipped, so that only the remaining windows are refreshed by posting messages.
+// Windows that fail to refresh are logged and left to message posting; an error is returned, and no window
+// is refreshed, if ShellWindows cannot be enumerated at all.
+//
+// Parameters:
+//
+//	ctx - Stops refreshing further windows when done.
+func (l *Library) refreshShellWindows(ctx context.Context) (map[winapi.HWND]bool, error) {
+	refreshed := map[winapi.HWND]bool{}
+	err := enumShellWindows(func(disp *comObject) bool {
+		l.refreshShellWindow(disp, refreshed)
+		return ctx.Err() == nil
+	})
+
+	return refreshed, err
+}
+
+// enumShellWindows calls visit with the IDispatch pointer of every window of the ShellWindows COM object (and, on
+// Windows 11, of every File Explorer tab), until visit returns false. The pointer is only valid during the call.
+// Returns an error if ShellWindows cannot be created or enumerated.
+//
+// COM threading: COM is initialized as a single-threaded apartment (STA) on the calling goroutine's OS thread,
+// which is locked for the duration of the call, since COM objects must only be used on the thread that created
+// them and the apartment must be uninitialized on that same thread. If the thread was already initialized as a
+// multithreaded apartment, that apartment is used instead. ShellWindows lives in the Explorer process, so every
+// call is marshalled there and blocks until Explorer answers.
+//
+// Parameters:
+//
+//	visit - Called for each window; returns whether to continue.
+func enumShellWindows(visit func(disp *comObject) bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	switch err := windows.CoInitializeEx(0, windows.COINIT_APARTMENTTHREADED); err {
+	case nil, syscall.Errno(windows.S_FALSE):
+		defer windows.CoUninitialize()
+	case syscall.Errno(windows.RPC_E_CHANGED_MODE):
+	default:
+		return fmt.Errorf("failed call to CoInitializeEx: %v", err)
+	}
+
+	var shellWindows *comObject
+	r1, _, _ := procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidShellWindows)),
+		0,
+		windows.CLSCTX_LOCAL_SERVER|windows.CLSCTX_INPROC_SERVER,
+		uintptr(unsafe.Pointer(&iidIShellWindows)),
+		uintptr(unsafe.Pointer(&shellWindows)),
+	)
+	if err := hresultError("CoCreateInstance", r1); err != nil {
+		return err
+	}
+	defer shellWindows.release()
+
+	var unknown *comObject
+	r1, _, _ = syscall.SyscallN(shellWindows.method(methodNewEnum), uintptr(unsafe.Pointer(shellWindows)), uintptr(unsafe.Pointer(&unknown)))
+	if err := hresultError("IShellWindows::_NewEnum", r1); err != nil {
+		return err
+	}
+	defer unknown.release()
+
+	var enum *comObject
+	r1, _, _ = syscall.SyscallN(unknown.method(methodQueryInterface), uintptr(unsafe.Pointer(unknown)),
+		uintptr(unsafe.Pointer(&iidIEnumVARIANT)), uintptr(unsafe.Pointer(&enum)))
+	if err := hresultError("QueryInterface", r1); err != nil {
+		return err
+	}
+	defer enum.release()
+
+	for {
+		var v variant
+		var fetched uint32
+		r1, _, _ = syscall.SyscallN(enum.method(methodEnumNext), uintptr(unsafe.Pointer(enum)), 1,
+			uintptr(unsafe.Pointer(&v)), uintptr(unsafe.Pointer(&fetched)))
+		if err := hresultError("IEnumVARIANT::Next", r1); err != nil {
+			return err
+		}
+		if fetched == 0 {
+			return nil
+		}
+
+		more := true
+		if v.vt == vtDispatch && v.disp != nil {
+			more = visit(v.disp)
+		}
+		_, _, _ = procVariantClear.Call(uintptr(unsafe.Pointer(&v)))
+		if !more {
+			return nil
+		}
+	}
+}
+
+// shellBrowser returns the IWebBrowser2 interface of a window of ShellWindows along with the handle of its
+// top-level window, which the caller must release. Returns an error if the window has no such interface (i.e.,
+// the call fails) or its handle cannot be retrieved.
+//
+// Parameters:
+//
+//	disp - The IDispatch pointer of the window, as passed by enumShellWindows.
+func shellBrowser(disp *comObject) (*comObject, winapi.HWND, error) {
+	var browser *comObject
+	r1, _, _ := syscall.SyscallN(disp.method(methodQueryInterface), uintptr(unsafe.Pointer(disp)),
+		uintptr(unsafe.Pointer(&iidIWebBrowser2)), uintptr(unsafe.Pointer(&browser)))
+	if err := hresultError("QueryInterface", r1); err != nil {
+		return nil, 0, err
+	}
+
+	var handle uintptr
+	r1, _, _ = syscall.SyscallN(browser.method(methodGetHWND), uintptr(unsafe.Pointer(browser)), uintptr(unsafe.Pointer(&handle)))
+	if err := hresultError("IWebBrowserApp::get_HWND", r1); err != nil {
+		browser.release()
+		return nil, 0, err
+	}
+
+	return browser, winapi.HWND(handle), nil
+}
+
+// shellFolders returns the file system folders shown by the windows of ShellWindows that belong to the top-level
+// window hwnd, i.e., one per tab on Windows 11 (see enumShellWindows). Locations that are not file system folders
+// (e.g., This PC or search results) are left out. Returns an error if ShellWindows cannot be enumerated.
+//
+// Parameters:
+//
+//	hwnd - The window handle of the File Explorer window.
+func shellFolders(hwnd winapi.HWND) ([]string, error) {
+	var folders []string
+	err := enumShellWindows(func(disp *comObject) bool {
+		browser, handle, err := shellBrowser(disp)
+		if err != nil || handle != hwnd {
+			return true
+		}
+		defer browser.release()
+
+		if folder := browserFolder(browser); folder != "" {
+			folders = append(folders, folder)
+		}
+		return true
+	})
+
+	return folders, err
+}
+
+// browserFolder returns the file system folder shown by a window of ShellWindows (see fileURLPath), or "" if it
+// shows something else or its location cannot be retrieved.
+//
+// Parameters:
+//
+//	browser - The IWebBrowser2 interface of the window, as returned by shellBrowser.
+func browserFolder(browser *comObject) string {
+	var location *uint16
+	r1, _, _ := syscall.SyscallN(browser.method(methodLocationURL), uintptr(unsafe.Pointer(browser)), uintptr(unsafe.Pointer(&location)))
+	if hresultError("IWebBrowser::get_LocationURL", r1) != nil || location == nil {
+		return ""
+	}
+	defer procSysFreeString.Call(uintptr(unsafe.Pointer(location)))
+
+	return fileURLPath(windows.UTF16PtrToString(location))
+}
+
+// fileURLPath returns the path of a "file" URL as reported by IWebBrowser::get_LocationURL (e.g., C:\dev for
+// file:///C:/dev, or \\server\share for file://server/share), or "" for any other location.
+//
+// Parameters:
+//
+//	location - The URL of the location.
+func fileURLPath(location string) string {
+	u, err := url.Parse(location)
+	if err != nil || !strings.EqualFold(u.Scheme, "file") || u.Path == "" {
+		return ""
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		return `\\` + u.Host + filepath.FromSlash(u.Path)
+	}
+
+	return filepath.FromSlash(strings.TrimPrefix(u.Path, "/"))
+}
+
+// refreshShellWindow refreshes a single window of ShellWindows through its IWebBrowser2 interface, if it belongs
+// to File Explorer (see refreshBrowser), and adds its handle to refreshed on success or if it is skipped for
+// --no-refresh-folder. On Windows 11, the windows of ShellWindows are tabs, so each tab is refreshed or skipped by
+// itself.
+//
+// Parameters:
+//
+//	disp      - The IDispatch pointer of the window, as returned by ShellWindows.
+//	refreshed - The handles of the windows refreshed so far.
+func (l *Library) refreshShellWindow(disp *comObject, refreshed map[winapi.HWND]bool) {
+	browser, hwnd, err := shellBrowser(disp)
+	if err != nil {
+		l.App.Logger.Debugf("Could not get the window of a shell window: %v", err)
+		return
+	}
+	defer browser.release()
+
+	if l.IsFileExplorer(hwnd) && l.refreshBrowser(browser, hwnd) {
+		refreshed[hwnd] = true
+	}
+}
+
+// refreshTabs refreshes the tabs of the File Explorer window hwnd one by one through COM (see refreshBrowser) if
+// any of them shows a folder listed with --no-refresh-folder (see noRefreshFolder), so that only the other tabs are
+// refreshed. Reports whether it did, in which case the window must not be refreshed as a whole; otherwise nothing is
+// refreshed. Returns an error if ShellWindows cannot be enumerated.
+//
+// Parameters:
+//
+//	hwnd - The window handle of the File Explorer window.
+func (l *Library) refreshTabs(hwnd winapi.HWND) (bool, error) {
+	folders, err := shellFolders(hwnd)
+	if err != nil || !slices.ContainsFunc(folders, l.noRefreshFolder) {
+		return false, err
+	}
+
+	return true, enumShellWindows(func(disp *comObject) bool {
+		browser, handle, err := shellBrowser(disp)
+		if err != nil || handle != hwnd {
+			return true
+		}
+		defer browser.release()
+
+		l.refreshBrowser(browser, hwnd)
+		return true
+	})
+}
+
+// refreshBrowser refreshes a window of ShellWindows (i.e., a tab on Windows 11) through IWebBrowser2::Refresh,
+// unless it shows a folder listed with --no-refresh-folder (see noRefreshFolder). Reports whether the window was
+// refreshed or skipped, i.e., false if refreshing it failed.
+//
+// Parameters:
+//
+//	browser - The IWebBrowser2 interface of the window, as returned by shellBrowser.
+//	hwnd    - The handle of its top-level window.
+func (l *Library) refreshBrowser(browser *comObject, hwnd winapi.HWND) bool {
+	if folder := browserFolder(browser); l.noRefreshFolder(folder) {
+		l.App.Logger.Debugf("Not refreshing %q in window %d", folder, hwnd)
+		return true
+	}
+
+	l.App.Logger.Debugf("Refreshing window handle %s through COM", l.describeWindow(hwnd))
+	r1, _, _ := syscall.SyscallN(browser.method(methodRefresh), uintptr(unsafe.Pointer(browser)))
+	if err := hresultError("IWebBrowser::Refresh", r1); err != nil {
+		l.warns.Warnf(l.App.Logger, "Could not refresh window handle %d through COM: %v", hwnd, err)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Sources of a flag's value, as printed by printConfig.
+const (
+	sourceDefault     = "default"
+	sourceCommandLine = "command line"
+	sourceEnvironment = "environment (SHOWALLFILES_CLI_ARGS)"
+	sourceRegistry    = "registry"
+	sourceFile        = "file"
+)
+
+// configSources maps the name of each flag set by loadConfig, or given on the command line, to the source of its
+// value. Flags that are not listed have their default value.
+var configSources = map[string]string{}
+
+// configDir returns the application's folder under the user's configuration directory (%AppData%),
+// which holds the configuration file and persisted state. It falls back to %TMP% if that cannot be determined.
+func configDir(appName string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = env["TMP"]
+	}
+
+	return filepath.Join(dir, appName)
+}
+
+// loadConfig reads the registry settings (see loadRegistryConfig) and then the JSON configuration file,
+// and applies their settings to the command-line flags. The file is a JSON object whose keys are long flag names
+// (e.g., "log-level") and whose values are strings, numbers, booleans, or arrays (for repeatable flags).
+// Flags given on the command line take precedence over the registry, which takes precedence over the file;
+// a flag that is already set is never overwritten. If --config is not set, the default config.json in configDir
+// is read if it exists. Unknown settings are reported to stderr and ignored. The source of each value that is set
+// is recorded in configSources for --print-config.
+func loadConfig(appName string) error {
+	// with DEBUG=true, the command line may have been replaced by SHOWALLFILES_CLI_ARGS (see init)
+	cmdline := sourceCommandLine
+	if debug && env["SHOWALLFILES_CLI_ARGS"] != "" {
+		cmdline = sourceEnvironment
+	}
+	pflag.Visit(func(f *pflag.Flag) { configSources[f.Name] = cmdline })
+
+	if err := loadRegistryConfig(appName); err != nil {
+		return err
+	}
+
+	path := flag.Config
+	if path == "" {
+		path = filepath.Join(configDir(appName), "config.json")
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && flag.Config == "" {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]any{}
+	if err = json.Unmarshal(b, &settings); err != nil {
+		return fmt.Errorf("failed to parse %q: %v", path, err)
+	}
+
+	var errs []error
+	for name, value := range settings {
+		f := pflag.Lookup(name)
+		if f == nil {
+			fmt.Fprintf(os.Stderr, "unknown config setting: %s\n", name)
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if err = pflag.Set(name, fmt.Sprint(v)); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value for config setting %q: %v", name, err))
+			}
+		}
+		configSources[name] = sourceFile + " " + path
+	}
+
+	return errors.Join(errs...)
+}
+
+// loadRegistryConfig reads the values of the key HKEY_CURRENT_USER\Software\<appName> and applies them to the
+// command-line flags that are not set yet. Value names are long flag names (e.g., "log-level"); REG_SZ and
+// REG_DWORD values set a flag once, and each string of a REG_MULTI_SZ value sets a repeatable flag. REG_DWORD values
+// of duration flags are taken as milliseconds. The key is created by the first setting stored with --set-config (see
+// setConfig), so nothing is done if it does not exist. Unknown settings are reported to stderr and ignored.
+//
+// Parameters:
+//
+//	appName - The name of the key under HKEY_CURRENT_USER\Software.
+func loadRegistryConfig(appName string) error {
+	path := `Software\` + appName
+	key, err := registry.OpenKey(registry.CURRENT_USER, path, registry.QUERY_VALUE)
+	if errors.Is(err, registry.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed call to OpenKey: %v", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	names, err := key.ReadValueNames(0)
+	if err != nil {
+		return fmt.Errorf("failed call to ReadValueNames: %v", err)
+	}
+
+	var errs []error
+	for _, name := range names {
+		f := pflag.Lookup(name)
+		if f == nil {
+			fmt.Fprintf(os.Stderr, "unknown registry setting: %s\n", name)
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+
+		values, err := registryValues(key, f)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for registry setting %q: %v", name, err))
+			continue
+		}
+		for _, v := range values {
+			if err = pflag.Set(name, v); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value for registry setting %q: %v", name, err))
+			}
+		}
+		configSources[name] = sourceRegistry + ` HKEY_CURRENT_USER\` + path
+	}
+	if err = errors.Join(errs...); err != nil {
+		return fmt.Errorf("registry key %q: %w", `HKEY_CURRENT_USER\`+path, err)
+	}
+
+	return nil
+}
+
+// registryValues returns the registry value named after the flag f as the strings to set it to. DWORD values of
+// duration flags are returned as milliseconds.
+//
+// Parameters:
+//
+//	key - The open registry key.
+//	f   - The flag the value is named after.
+func registryValues(key registry.Key, f *pflag.Flag) ([]string, error) {
+	name := f.Name
+	_, valtype, err := key.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch valtype {
+	case registry.SZ, registry.EXPAND_SZ:
+		value, _, err := key.GetStringValue(name)
+		if err != nil {
+			return nil, err
+		}
+		return []string{value}, nil
+	case registry.DWORD, registry.QWORD:
+		value, _, err := key.GetIntegerValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if f.Value.Type() == "duration" {
+			return []string{strconv.FormatUint(value, 10) + "ms"}, nil
+		}
+		return []string{strconv.FormatUint(value, 10)}, nil
+	case registry.MULTI_SZ:
+		values, _, err := key.GetStringsValue(name)
+		return values, err
+	default:
+		return nil, fmt.Errorf("unsupported value type %d", valtype)
+	}
+}
+
+// setConfig parses assignment as name=value and stores the setting as a value of the key
+// HKEY_CURRENT_USER\Software\<appName>, which is created if it does not exist yet, for loadRegistryConfig to apply
+// on the next run. The name is a long flag name and the value is checked the way the flag parses it; repeatable flags
+// are stored as a REG_MULTI_SZ value and all other flags as a REG_SZ value. An empty value deletes the setting.
+// Returns the exit code for the command.
+//
+// Parameters:
+//
+//	appName    - The name of the key under HKEY_CURRENT_USER\Software.
+//	assignment - The flag name and value to store, separated by "=".
+func setConfig(appName, assignment string) int {
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok || name == "" {
+		fmt.Fprintf(os.Stderr, "Invalid assignment %q, expected name=value\n", assignment)
+		return ExitUsage
+	}
+	f := pflag.Lookup(name)
+	if f == nil || f.Hidden || name == "set-config" {
+		fmt.Fprintf(os.Stderr, "unknown config setting: %s\n", name)
+		return ExitUsage
+	}
+	if value != "" {
+		if err := f.Value.Set(value); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid value for config setting %q: %v\n", name, err)
+			return ExitUsage
+		}
+	}
+
+	path := `Software\` + appName
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.SET_VALUE)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open registry key %q: %v\n", `HKEY_CURRENT_USER\`+path, err)
+		return ExitFatal
+	}
+	defer func() { _ = key.Close() }()
+
+	switch _, repeatable := f.Value.(pflag.SliceValue); {
+	case value == "":
+		err = key.DeleteValue(name)
+		if errors.Is(err, registry.ErrNotExist) {
+			err = nil
+		}
+	case repeatable:
+		err = key.SetStringsValue(name, []string{value})
+	default:
+		err = key.SetStringValue(name, value)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to store config setting %q: %v\n", name, err)
+		return ExitFatal
+	}
+
+	return ExitOK
+}
+
+// configEntry is the effective value of a flag and its source, as printed by printConfig.
+type configEntry struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+// printConfig prints the effective value of every visible flag, once the registry and configuration file are applied
+// by loadConfig, along with where it came from: the command line, the registry, the file, or the default.
+// Repeatable flags are printed as a list. Returns the exit code for the command.
+//
+// Parameters:
+//
+//	format - How to print the configuration: outputTable or outputJSON (see writeOutput).
+func printConfig(format string) int {
+	entries := map[string]configEntry{}
+	var names []string
+	pflag.VisitAll(func(f *pflag.Flag) {
+		if f.Hidden || f.Name == "print-config" {
+			return
+		}
+
+		entry := configEntry{Value: f.Value.String(), Source: sourceDefault}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			entry.Value = sv.GetSlice()
+		}
+		if source, ok := configSources[f.Name]; ok {
+			entry.Source = source
+		}
+		entries[f.Name] = entry
+		names = append(names, f.Name)
+	})
+
+	out := output{JSON: entries, Header: []string{"FLAG", "VALUE", "SOURCE"}}
+	for _, name := range names {
+		out.Rows = append(out.Rows, []any{name, entries[name].Value, entries[name].Source})
+	}
+	if err := writeOutput(os.Stdout, format, out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+		return ExitFatal
+	}
+
+	return ExitOK
+}
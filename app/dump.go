@@ -0,0 +1,79 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/kamaranl/winapi"
+)
+
+// dumpedWindow is a window printed by dumpWindows.
+type dumpedWindow struct {
+	HWND       uintptr `json:"hwnd"`
+	Class      string  `json:"class"`
+	PID        uint32  `json:"pid"`
+	Explorer   bool    `json:"explorer"`
+	Executable string  `json:"executable"`
+}
+
+// dumpWindowClasses lists the window classes used by File Explorer windows, which are always dumped by dumpWindows.
+var dumpWindowClasses = []string{"CabinetWClass", "ExploreWClass"}
+
+// dumpWindows enumerates all top-level windows and prints a table of the candidate windows to stdout: those with a
+// File Explorer window class or a class listed with --refresh-class, and those matched by IsFileExplorer.
+// For each, the handle, class name, process ID, executable, and whether IsFileExplorer matched it are printed, which
+// helps diagnosing windows that are not detected (e.g., those of third-party shells or an elevated Explorer).
+// With --output=json, the windows are printed as a JSON array instead. Returns the exit code for the command.
+func (a *Application) dumpWindows() int {
+	lib, ok := a.Lib.(*Library)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Failed to enumerate windows: not supported by this API implementation")
+		return ExitFatal
+	}
+
+	dumped := []dumpedWindow{}
+	out := output{Header: []string{"HWND", "CLASS", "PID", "EXPLORER", "EXECUTABLE"}}
+	err := lib.visitWindows(func(hwnd winapi.HWND, explorer bool) {
+		class := className(hwnd)
+		if !explorer && !isDumpCandidate(class, a.Config.RefreshClasses) {
+			return
+		}
+
+		pid, exe, err := windowProcess(hwnd)
+		if err != nil {
+			exe = fmt.Sprintf("unknown (%v)", err)
+		}
+		dumped = append(dumped, dumpedWindow{uintptr(hwnd), class, pid, explorer, exe})
+		out.Rows = append(out.Rows, []any{hwnd, class, pid, explorer, exe})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to enumerate windows: %v\n", err)
+		return ExitFatal
+	}
+
+	out.JSON = dumped
+	if err = writeOutput(os.Stdout, flag.Output, out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print windows: %v\n", err)
+		return ExitFatal
+	}
+
+	return ExitOK
+}
+
+// isDumpCandidate reports whether a window with the given class name is printed by dumpWindows.
+func isDumpCandidate(class string, refreshClasses []string) bool {
+	for _, candidate := range slices.Concat(dumpWindowClasses, refreshClasses) {
+		if strings.EqualFold(class, candidate) {
+			return true
+		}
+	}
+
+	return false
+}
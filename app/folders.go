@@ -0,0 +1,253 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/kamaranl/winapi"
+	"golang.org/x/sys/windows"
+)
+
+// WatchForegroundFolders shows hidden files while a File Explorer window showing one of the folders listed with
+// --show-in-folder (or a folder below one) is in the foreground, and hides them again once another window is brought
+// to the foreground. If hidden files were already shown when the folder was brought to the foreground, they are left
+// shown. The value to restore is tracked in the state under "folder_rule"; toggling in the meantime cancels the
+// restore (see ToggleHidden), and exiting restores it (see onExit).
+//
+// The folder of a window is resolved through ShellWindows (see shellFolders) on a best-effort basis, and only when
+// the foreground window changes, so navigating to another folder within the same window is not noticed until the
+// window is brought to the foreground again. Nothing is started without --show-in-folder.
+func (l *Library) WatchForegroundFolders() {
+	if len(l.App.Config.ShowFolders) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	if l.foreground == nil {
+		l.foreground = make(chan winapi.HWND, 1)
+	}
+	foreground := l.foreground
+	l.mu.Unlock()
+
+	errCh := l.App.ErrCh
+	goTracked(&l.App.wg, l.App.Logger, "foreground folder hook", 0, func() {
+		// the hook's events are delivered to the message loop of the thread that set it
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hook, err := winapi.SetWinEventHook(
+			winapi.EVENT_SYSTEM_FOREGROUND,
+			winapi.EVENT_SYSTEM_FOREGROUND,
+			0,
+			l.foregroundCallback(),
+			0,
+			0,
+			winapi.WINEVENT_OUTOFCONTEXT,
+		)
+		if err != nil {
+			errCh <- fmt.Errorf("failed call to SetWinEventHook: %v", err)
+			return
+		}
+		defer func() { _ = winapi.UnhookWinEvent(hook) }()
+
+		threadId := windows.GetCurrentThreadId()
+		done := make(chan struct{})
+		defer close(done)
+		goSafe(l.App.Logger, "foreground folder hook helper", 0, func() {
+			select {
+			case <-l.App.done:
+			case <-done:
+				return
+			}
+			if err := winapi.PostThreadMessage(threadId, winapi.WM_QUIT, 0, 0); err != nil {
+				l.App.Logger.Warnf("Could not post WM_QUIT to thread %d: %v", threadId, err)
+			}
+		})
+
+		l.App.Logger.Debugf("Watching the foreground window for folders %q", l.App.Config.ShowFolders)
+		var msg winapi.MSG
+		for {
+			// see WaitForExplorer
+			r1, err := winapi.GetMessage(msg, 0, 0, 0)
+			if r1 == 0 {
+				return
+			}
+			if int32(r1) == -1 {
+				errCh <- fmt.Errorf("failed call to GetMessage: %v", err)
+				return
+			}
+			_ = winapi.TranslateMessage(msg)
+			winapi.DispatchMessage(msg)
+		}
+	})
+
+	// resolving folders calls into the Explorer process, so it is kept off the hook's thread
+	goTracked(&l.App.wg, l.App.Logger, "foreground folder rules", watcherRestarts, func() {
+		for {
+			select {
+			case hwnd := <-foreground:
+				l.applyFolderRule(hwnd)
+			case <-l.App.done:
+				return
+			}
+		}
+	})
+}
+
+// applyFolderRule shows hidden files if hwnd, which was just brought to the foreground, is a File Explorer window
+// showing a folder listed with --show-in-folder, and restores the value from before otherwise, as described for
+// WatchForegroundFolders. Errors are logged.
+//
+// Parameters:
+//
+//	hwnd - The window handle of the foreground window.
+func (l *Library) applyFolderRule(hwnd winapi.HWND) {
+	folder := ""
+	if l.IsFileExplorer(hwnd) {
+		path, err := l.explorerFolder(hwnd)
+		if err != nil {
+			l.App.Logger.Debugf("Could not resolve the folder of window %d: %v", hwnd, err)
+		}
+		folder = folderRule(l.App.Config.ShowFolders, path)
+	}
+
+	restore, active := state.Get[uint64]("folder_rule")
+	switch {
+	case folder != "" && !active:
+		value, err := l.GetValue("Hidden")
+		if err != nil {
+			l.App.Logger.Errorf("%v", err)
+			return
+		}
+		state.Set("folder_rule", value)
+		if value != statusHidden {
+			return
+		}
+		l.App.Logger.Infof("Showing hidden files while %q is in the foreground", folder)
+		if err := l.SetHidden(statusVisible); err != nil {
+			l.App.Logger.Errorf("Could not show hidden files: %v", err)
+		}
+
+	case folder == "" && active:
+		state.Delete("folder_rule")
+		if restore != statusHidden {
+			return
+		}
+		l.App.Logger.Infof("Hiding hidden files again after leaving the folder")
+		if err := l.SetHidden(statusHidden); err != nil {
+			l.App.Logger.Errorf("Could not hide hidden files again: %v", err)
+		}
+	}
+}
+
+// explorerFolder returns the file system folder shown by a File Explorer window (see shellFolders), or "" if it
+// shows something else (e.g., This PC). On Windows 11, where a window has a folder per tab, the folder of the active
+// tab is picked by matching the window title against it, which is either the folder's name or its full path (when
+// "Display the full path in the title bar" is enabled).
+//
+// Parameters:
+//
+//	hwnd - The window handle of the File Explorer window.
+func (l *Library) explorerFolder(hwnd winapi.HWND) (string, error) {
+	folders, err := shellFolders(hwnd)
+	switch {
+	case err != nil, len(folders) == 0:
+		return "", err
+	case len(folders) == 1:
+		return folders[0], nil
+	}
+
+	title := l.windowTitle(hwnd)
+	for _, folder := range folders {
+		if strings.EqualFold(title, folder) || strings.EqualFold(title, filepath.Base(folder)) {
+			return folder, nil
+		}
+	}
+
+	return "", nil
+}
+
+// folderRule returns the folder of folders that path is, or is below, matched case-insensitively, or "" if there
+// is none (or path is empty).
+//
+// Parameters:
+//
+//	folders - The folders listed with --show-in-folder.
+//	path    - The folder shown by the foreground window.
+func folderRule(folders []string, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	path = filepath.Clean(path)
+	for _, folder := range folders {
+		folder = filepath.Clean(folder)
+		prefix := folder
+		if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+			prefix += string(filepath.Separator)
+		}
+		if strings.EqualFold(path, folder) ||
+			len(path) > len(prefix) && strings.EqualFold(path[:len(prefix)], prefix) {
+			return folder
+		}
+	}
+
+	return ""
+}
+
+// foregroundCallback returns the callback for foregroundEventProc, creating it on first use.
+// Like winEventCallback, a single callback is reused for every hook.
+func (l *Library) foregroundCallback() uintptr {
+	l.foregroundOnce.Do(func() {
+		l.foregroundCall = windows.NewCallback(l.foregroundEventProc)
+	})
+
+	return l.foregroundCall
+}
+
+// foregroundEventProc is the WinEvent hook procedure of WatchForegroundFolders. It passes the handle of every window
+// brought to the foreground on to be checked (see applyFolderRule), replacing one that has not been checked yet, so
+// that quickly switching between windows only checks the last one. Like winEventProc, it ignores events for
+// non-root objects (objectId != 0) and always returns 0.
+//
+// Parameters:
+//
+//	eventHook     - Handle to the event hook.
+//	event         - Event type identifier.
+//	hwnd          - Handle to the window receiving the event.
+//	objectId      - Object identifier for the event.
+//	childId       - Child identifier for the event.
+//	eventThreadId - Thread ID where the event occurred.
+//	eventTime     - Timestamp of the event.
+func (l *Library) foregroundEventProc(eventHook windows.Handle, event uint32, hwnd winapi.HWND, objectId, childId int32,
+	eventThreadId, eventTime uint32,
+) uintptr {
+	defer recoverCallback(l.App.Logger, "foregroundEventProc")
+
+	if objectId != 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	foreground := l.foreground
+	l.mu.Unlock()
+	for {
+		select {
+		case foreground <- hwnd:
+			return 0
+		default:
+		}
+		select {
+		case <-foreground:
+		default:
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+)
+
+// toggleHistorySize is the number of committed toggles that can be undone.
+const toggleHistorySize = 10
+
+// toggleChange is a committed change of the "Hidden" value, as recorded in toggleHistory.
+type toggleChange struct {
+	old, new uint64
+}
+
+// toggleHistory holds the toggles that can be undone (oldest first, at most toggleHistorySize) and those that
+// were undone and can be redone. It only lives as long as the session.
+type toggleHistory struct {
+	mu   sync.Mutex
+	undo []toggleChange
+	redo []toggleChange
+}
+
+// record adds a committed toggle to the history, dropping the oldest one if it is full,
+// and clears the toggles that could be redone, since they no longer follow from the current value.
+func (h *toggleHistory) record(change toggleChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.undo = append(h.undo, change)
+	if len(h.undo) > toggleHistorySize {
+		h.undo = h.undo[len(h.undo)-toggleHistorySize:]
+	}
+	h.redo = nil
+}
+
+// available reports whether there are toggles to undo and to redo.
+func (h *toggleHistory) available() (undo, redo bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.undo) > 0, len(h.redo) > 0
+}
+
+// UndoToggle reverts the last committed toggle (see ToggleHidden) by writing back the value it replaced.
+// It returns an error if there is nothing to undo or the value cannot be written. If the registry no longer
+// holds the value written by that toggle (i.e., it was changed elsewhere since), the history is discarded
+// instead, since it no longer describes how the current value came about.
+func (l *Library) UndoToggle() error {
+	return l.replayToggle(true)
+}
+
+// RedoToggle writes the value of the last toggle reverted by UndoToggle again. It returns an error if there is
+// nothing to redo or the value cannot be written. A new toggle discards the toggles that could be redone.
+func (l *Library) RedoToggle() error {
+	return l.replayToggle(false)
+}
+
+// replayToggle implements UndoToggle (if undo is true) and RedoToggle, moving the change from one side of the
+// history to the other once it was written. The write is recorded in the audit log.
+func (l *Library) replayToggle(undo bool) error {
+	l.history.mu.Lock()
+	from, to := &l.history.redo, &l.history.undo
+	source := sourceRedo
+	if undo {
+		from, to = to, from
+		source = sourceUndo
+	}
+	if len(*from) == 0 {
+		l.history.mu.Unlock()
+		return errors.New("no toggle to " + source)
+	}
+	change := (*from)[len(*from)-1]
+	l.history.mu.Unlock()
+
+	want, expect := change.new, change.old
+	if undo {
+		want, expect = change.old, change.new
+	}
+
+	current, err := l.GetValue("Hidden")
+	if err != nil {
+		return err
+	}
+	if current != expect {
+		l.history.mu.Lock()
+		l.history.undo, l.history.redo = nil, nil
+		l.history.mu.Unlock()
+		l.RefreshSystray()
+		return errors.New("the setting was changed elsewhere; toggle history discarded")
+	}
+
+	entry := auditEntry{Time: time.Now(), Old: current, New: want, Source: source, Success: true}
+	state.Set("status_source", source)
+	if err = l.writeToggle(want); err != nil {
+		state.Delete("status_source")
+		entry.Success, entry.Error = false, err.Error()
+		l.App.audit(entry)
+		return err
+	}
+	l.App.audit(entry)
+	l.App.Logger.Infof("Performed %s of toggle: set 'Hidden' value from %d to %d", source, current, want)
+
+	l.history.mu.Lock()
+	if n := len(*from); n > 0 && (*from)[n-1] == change {
+		*from = (*from)[:n-1]
+		*to = append(*to, change)
+	}
+	l.history.mu.Unlock()
+	l.RefreshSystray()
+
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.design/x/hotkey"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	// toggleMods and toggleKey define the global hotkey that toggles hidden files (Win+Shift+.).
+	toggleMods = []hotkey.Modifier{hotkey.ModWin, hotkey.ModShift}
+	toggleKey  = hotkey.Key(windows.VK_OEM_PERIOD)
+
+	// quitKey and aboutKey are pressed along with the modifiers given with --accelerators to quit the application
+	// and show the About dialog, respectively (see listenAccelerators).
+	quitKey  = hotkey.KeyQ
+	aboutKey = hotkey.KeyA
+
+	// modifierNames maps hotkey modifiers to their human-readable names.
+	modifierNames = map[hotkey.Modifier]string{
+		hotkey.ModAlt:   "Alt",
+		hotkey.ModCtrl:  "Ctrl",
+		hotkey.ModShift: "Shift",
+		hotkey.ModWin:   "Win",
+	}
+
+	// keyNames maps virtual-key codes that are not letters, digits, or function keys to human-readable names.
+	keyNames = map[hotkey.Key]string{
+		hotkey.KeySpace:                   "Space",
+		hotkey.KeyReturn:                  "Enter",
+		hotkey.KeyEscape:                  "Esc",
+		hotkey.KeyDelete:                  "Del",
+		hotkey.KeyTab:                     "Tab",
+		hotkey.KeyLeft:                    "Left",
+		hotkey.KeyRight:                   "Right",
+		hotkey.KeyUp:                      "Up",
+		hotkey.KeyDown:                    "Down",
+		hotkey.Key(windows.VK_OEM_PERIOD): ".",
+		hotkey.Key(windows.VK_OEM_COMMA):  ",",
+		hotkey.Key(windows.VK_OEM_MINUS):  "-",
+		hotkey.Key(windows.VK_OEM_PLUS):   "=",
+		hotkey.Key(windows.VK_OEM_1):      ";",
+		hotkey.Key(windows.VK_OEM_2):      "/",
+		hotkey.Key(windows.VK_OEM_3):      "`",
+		hotkey.Key(windows.VK_OEM_4):      "[",
+		hotkey.Key(windows.VK_OEM_5):      `\`,
+		hotkey.Key(windows.VK_OEM_6):      "]",
+		hotkey.Key(windows.VK_OEM_7):      "'",
+	}
+)
+
+// parseModifiers parses a "+"-separated list of modifier names (e.g., "Ctrl+Alt"), as in modifierNames but matched
+// case-insensitively, into hotkey modifiers in the given order.
+// Returns an error if no modifier is given, or if a name is unknown or repeated. A single modifier is only accepted if
+// it is Alt or Win, since Ctrl or Shift alone along with Q or A would take over typing those letters (e.g., Shift+Q)
+// or common shortcuts (e.g., Ctrl+A) in every application.
+//
+// Parameters:
+//
+//	s - The modifier names (e.g., the value of --accelerators).
+func parseModifiers(s string) ([]hotkey.Modifier, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("no modifier given")
+	}
+
+	var mods []hotkey.Modifier
+	for _, name := range strings.Split(s, "+") {
+		name = strings.TrimSpace(name)
+		var mod hotkey.Modifier
+		for m, n := range modifierNames {
+			if strings.EqualFold(n, name) {
+				mod = m
+				break
+			}
+		}
+		switch {
+		case mod == 0:
+			return nil, fmt.Errorf("unknown modifier %q (expected Alt, Ctrl, Shift, or Win)", name)
+		case slices.Contains(mods, mod):
+			return nil, fmt.Errorf("modifier %q given more than once", name)
+		}
+		mods = append(mods, mod)
+	}
+	if len(mods) == 1 && mods[0] != hotkey.ModAlt && mods[0] != hotkey.ModWin {
+		return nil, fmt.Errorf("modifier %q must be combined with another one", modifierNames[mods[0]])
+	}
+
+	return mods, nil
+}
+
+// hotkeyLabel returns a human-readable representation of a hotkey, e.g., "Win+Shift+.".
+//
+// Parameters:
+//
+//	mods - The modifiers of the hotkey, in the order they should be displayed.
+//	key  - The key of the hotkey.
+func hotkeyLabel(mods []hotkey.Modifier, key hotkey.Key) string {
+	parts := make([]string, 0, len(mods)+1)
+	for _, mod := range mods {
+		parts = append(parts, modifierNames[mod])
+	}
+
+	name, ok := keyNames[key]
+	switch {
+	case ok:
+	case key >= hotkey.Key0 && key <= hotkey.Key9, key >= hotkey.KeyA && key <= hotkey.KeyZ:
+		name = string(rune(key))
+	case key >= hotkey.KeyF1 && key <= hotkey.KeyF20:
+		name = fmt.Sprintf("F%d", key-hotkey.KeyF1+1)
+	default:
+		name = fmt.Sprintf("0x%02X", uint16(key))
+	}
+
+	return strings.Join(append(parts, name), "+")
+}
@@ -0,0 +1,440 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+)
+
+// httpShutdownTimeout is how long the control server started with --http waits for requests in progress to
+// finish when the application stops.
+const httpShutdownTimeout = 2 * time.Second
+
+// httpStatusTimeout is how long --status waits for the control server of the running instance (see runningStatus).
+const httpStatusTimeout = 2 * time.Second
+
+// Limits of a POST /batch request: the size of its body and the number of commands it may hold.
+const (
+	batchMaxBytes    = 64 << 10
+	batchMaxCommands = 64
+)
+
+// Commands of a POST /batch request (see batchCommand).
+const (
+	batchShow    = "show"
+	batchHide    = "hide"
+	batchSet     = "set"
+	batchRefresh = "refresh"
+	batchStatus  = "status"
+)
+
+// httpStatus is the JSON response of the control server, describing the visibility of hidden files and whether the
+// registry watcher is running and ready (see setWatcherReady), along with its last error, and how many entries the
+// state store holds.
+type httpStatus struct {
+	Hidden         bool   `json:"hidden"`
+	Value          uint64 `json:"value"`
+	WatcherRunning bool   `json:"watcher_running"`
+	WatcherReady   bool   `json:"watcher_ready"`
+	WatcherError   string `json:"watcher_error,omitempty"`
+	StateEntries   int    `json:"state_entries"`
+}
+
+// checkLoopback returns an error unless addr is a host:port address whose host is a loopback IP address
+// (e.g., 127.0.0.1 or ::1), so that the control server is never reachable from other devices.
+//
+// Parameters:
+//
+//	addr - The address given with --http.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q is not a loopback IP address", host)
+	}
+
+	return nil
+}
+
+// serveHTTP starts the control server selected with --http on addr, which must have been validated with
+// checkLoopback, and stops it once the application is stopped. It serves the following JSON endpoints:
+//
+//   - GET /status: Reports whether hidden files are hidden, along with the raw "Hidden" value, and whether the
+//     registry watcher is running, along with its last error.
+//   - POST /toggle: Toggles the visibility of hidden files, like the hotkey, and reports the new status.
+//   - POST /show, POST /hide: Makes hidden files visible or hidden like a toggle, and reports the new status.
+//   - POST /batch: Runs several commands in order and reports the result of each (see handleBatch).
+//   - POST /quit: Quits the application.
+//
+// Requests with an Origin header, or addressed to any host other than addr (or localhost on its port), are refused,
+// so that web pages cannot reach the server from a browser (including through DNS rebinding). Returns an error if
+// addr cannot be listened on.
+//
+// Parameters:
+//
+//	addr - The loopback address to listen on, as host:port.
+func (a *Application) serveHTTP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", a.handleStatus)
+	mux.HandleFunc("POST /toggle", func(w http.ResponseWriter, r *http.Request) {
+		if writeRequestError(w, a.Lib.RequestToggle(sourceHTTP)) {
+			return
+		}
+		a.handleStatus(w, r)
+	})
+	mux.HandleFunc("POST /show", a.handleSet(statusVisible))
+	mux.HandleFunc("POST /hide", a.handleSet(statusHidden))
+	mux.HandleFunc("POST /batch", a.handleBatch)
+	mux.HandleFunc("POST /quit", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusAccepted, map[string]bool{"quitting": true})
+		go a.requestQuit()
+	})
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	hosts := []string{listener.Addr().String(), addr, net.JoinHostPort("localhost", port)}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Origin") != "" || !slices.ContainsFunc(hosts, func(host string) bool {
+				return strings.EqualFold(r.Host, host)
+			}) {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+				return
+			}
+			a.Logger.Debugf("HTTP request: %s %s", r.Method, r.URL.Path)
+			mux.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-a.done
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+	go func() {
+		a.Logger.Infof("Serving the HTTP control server on %s", listener.Addr())
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			a.Logger.Errorf("HTTP control server stopped: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// handleStatus responds with the status of hidden files (see httpStatusNow).
+func (a *Application) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	status, err := a.httpStatusNow()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+// httpStatusNow returns the status of hidden files as returned by currentHidden, which reflects a toggle right away
+// even while its registry write is still pending (see ToggleHidden), along with the state of the registry watcher.
+// Returns an error if the "Hidden" value cannot be read.
+func (a *Application) httpStatusNow() (httpStatus, error) {
+	value, err := a.currentHidden()
+	if err != nil {
+		return httpStatus{}, err
+	}
+	ready, _ := state.Get[bool]("watcher_ready")
+
+	return httpStatus{
+		Hidden:         value == statusHidden,
+		Value:          value,
+		WatcherRunning: a.Lib.WatcherRunning(),
+		WatcherReady:   ready,
+		WatcherError:   a.Lib.WatcherError(),
+		StateEntries:   state.Len(),
+	}, nil
+}
+
+// runningStatus asks the control server of the running instance, listening on addr (--http, e.g., given in the
+// configuration file shared with that instance), for its status (GET /status), e.g., to report on its registry
+// watcher. Returns an error if addr is empty or the server does not respond with a status within
+// httpStatusTimeout.
+//
+// Parameters:
+//
+//	addr - The address the control server listens on, as host:port.
+func runningStatus(addr string) (httpStatus, error) {
+	if addr == "" {
+		return httpStatus{}, errors.New("no running instance to ask; see --http")
+	}
+
+	client := http.Client{Timeout: httpStatusTimeout}
+	resp, err := client.Get("http://" + addr + "/status")
+	if err != nil {
+		return httpStatus{}, fmt.Errorf("failed call to GET /status: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return httpStatus{}, fmt.Errorf("GET /status responded with %s", resp.Status)
+	}
+
+	var status httpStatus
+	if err = json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return httpStatus{}, fmt.Errorf("invalid status: %v", err)
+	}
+
+	return status, nil
+}
+
+// currentHidden returns the "Hidden" value stored in the state, or reads it from the registry if the state
+// does not hold it yet.
+func (a *Application) currentHidden() (uint64, error) {
+	if value, ok := state.Get[uint64]("status_hidden"); ok {
+		return value, nil
+	}
+
+	return a.Lib.GetValue("Hidden")
+}
+
+// handleSet returns a handler that sets the given "Hidden" value like a toggle (see RequestHidden), so that the
+// change is coalesced with toggles, recorded in the history and the audit log, and announced like one, and responds
+// with the new status. A refused change is reported as by writeRequestError.
+//
+// Parameters:
+//
+//	value - The hidden files status to set (statusVisible or statusHidden).
+func (a *Application) handleSet(value uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if writeRequestError(w, a.Lib.RequestHidden(value, sourceHTTP)) {
+			return
+		}
+		a.Logger.Infof("Requested 'Hidden' value %d over HTTP", value)
+		a.handleStatus(w, r)
+	}
+}
+
+// writeRequestError responds with the error of a toggle or another requested change of "Hidden" (see RequestToggle
+// and RequestHidden), if any: 403 Forbidden with --read-only, 409 Conflict for a while after a policy overrode the
+// setting, and 500 Internal Server Error otherwise.
+// Returns whether a response was written.
+//
+// Parameters:
+//
+//	w   - The response to write to.
+//	err - The error returned by the request.
+func writeRequestError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errReadOnly):
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, errPolicyOverride):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return true
+}
+
+// batchCommand is a command of a POST /batch request, given either as its name (e.g., "show") or as an object
+// naming it along with its arguments (e.g., {"command":"set","name":"HideFileExt","value":0}).
+type batchCommand struct {
+	Command string  `json:"command"`
+	Name    string  `json:"name,omitempty"`  // registry value written by "set"
+	Value   *uint32 `json:"value,omitempty"` // DWORD written by "set"
+}
+
+// UnmarshalJSON decodes a batchCommand from either its name or an object.
+func (c *batchCommand) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &c.Command); err == nil {
+		return nil
+	}
+
+	type plain batchCommand
+	return json.Unmarshal(b, (*plain)(c))
+}
+
+// validate returns an error if the command is unknown, lacks its arguments, or would write a registry value that
+// may not be written (see settingAllowed), which wraps errReadOnly if it would write "Hidden" with --read-only.
+//
+// Parameters:
+//
+//	readOnly - Whether --read-only is set.
+func (c batchCommand) validate(readOnly bool) error {
+	switch c.Command {
+	case batchShow, batchHide:
+		if readOnly {
+			return errReadOnly
+		}
+	case batchSet:
+		switch {
+		case c.Name == "" || c.Value == nil:
+			return errors.New(`"set" requires "name" and "value"`)
+		case !settingAllowed(c.Name):
+			return fmt.Errorf("refusing to write unknown value %q without --force", c.Name)
+		case !strings.EqualFold(c.Name, "Hidden"):
+		case readOnly:
+			return errReadOnly
+		case uint64(*c.Value) != statusVisible && uint64(*c.Value) != statusHidden:
+			return fmt.Errorf("invalid value %d for 'Hidden', expected %d or %d", *c.Value, statusVisible, statusHidden)
+		}
+	case batchRefresh, batchStatus:
+	default:
+		return fmt.Errorf("unknown command %q (expected show, hide, set, refresh, or status)", c.Command)
+	}
+
+	return nil
+}
+
+// batchResult is the result of a command of a POST /batch request. Windows is set by "refresh" and Status by
+// "status"; commands after a failed one are not run and reported as skipped.
+type batchResult struct {
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	Skipped bool        `json:"skipped,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Windows *int        `json:"windows,omitempty"`
+	Status  *httpStatus `json:"status,omitempty"`
+}
+
+// batchResponse is the JSON response to a POST /batch request: whether every command succeeded, and the result of
+// each command in the order of the request.
+type batchResponse struct {
+	OK      bool          `json:"ok"`
+	Results []batchResult `json:"results"`
+}
+
+// handleBatch runs the commands of a POST /batch request, a JSON array of batchCommand, in order, so that automation
+// can, e.g., write several values and refresh the windows once in a single request:
+//
+//   - show, hide: Makes hidden files visible or hidden (see handleSet).
+//   - set: Writes the DWORD value "value" to the registry value "name", which must be listed in settingNames unless
+//     --force is set. "Hidden" only takes statusVisible or statusHidden.
+//   - refresh: Refreshes all open File Explorer windows and reports how many were found.
+//   - status: Reports the status, as GET /status does.
+//
+// Refreshing File Explorer windows after a change is suspended while the batch runs and for notifyWindow after it
+// (see refreshSuspended), so that the registry watcher does not refresh them for each write, and only "refresh" does.
+// Batches run one at a time, and writes of "Hidden" cancel the changes scheduled for later (see batchHidden).
+// Toggling is not available, since toggles are written asynchronously (see ToggleHidden). Every command is
+// validated before any is run: an invalid request is refused with 400 Bad Request, or with 403 Forbidden if it would
+// write "Hidden" with --read-only, and nothing is run. Otherwise, the commands are run until one fails, the rest are
+// skipped, and the response (see batchResponse) is sent with 200 OK either way.
+func (a *Application) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var commands []batchCommand
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, batchMaxBytes)).Decode(&commands); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid batch: %v", err)})
+		return
+	}
+	if len(commands) == 0 || len(commands) > batchMaxCommands {
+		writeJSON(w, http.StatusBadRequest,
+			map[string]string{"error": fmt.Sprintf("a batch holds 1 to %d commands", batchMaxCommands)})
+		return
+	}
+	for i, c := range commands {
+		if err := c.validate(a.Config.ReadOnly); err != nil {
+			code := http.StatusBadRequest
+			if errors.Is(err, errReadOnly) {
+				code = http.StatusForbidden
+			}
+			writeJSON(w, code, map[string]string{"error": fmt.Sprintf("command %d: %v", i+1, err)})
+			return
+		}
+	}
+
+	// batches run one at a time, so that they neither interleave their writes nor end each other's suspension
+	a.batchMu.Lock()
+	defer a.batchMu.Unlock()
+
+	state.Set("refresh_suspended", true)
+	defer state.SetTTL("refresh_suspended", true, a.Config.notifyWindow(), nil)
+
+	response := batchResponse{OK: true, Results: make([]batchResult, len(commands))}
+	for i, c := range commands {
+		if !response.OK {
+			response.Results[i] = batchResult{Command: c.Command, Skipped: true}
+			continue
+		}
+		response.Results[i] = a.runBatchCommand(c)
+		response.OK = response.Results[i].OK
+	}
+	a.Logger.Infof("Ran a batch of %d commands over HTTP", len(commands))
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// runBatchCommand runs a validated command of a POST /batch request (see handleBatch) and returns its result.
+//
+// Parameters:
+//
+//	c - The command to run.
+func (a *Application) runBatchCommand(c batchCommand) batchResult {
+	result := batchResult{Command: c.Command}
+
+	var err error
+	switch c.Command {
+	case batchShow:
+		err = a.batchHidden(statusVisible)
+	case batchHide:
+		err = a.batchHidden(statusHidden)
+	case batchSet:
+		if strings.EqualFold(c.Name, "Hidden") {
+			err = a.batchHidden(uint64(*c.Value))
+		} else {
+			err = a.Lib.SetValue(c.Name, *c.Value)
+		}
+	case batchRefresh:
+		windows := a.Lib.RefreshExplorerWindows()
+		result.Windows = &windows
+	case batchStatus:
+		var status httpStatus
+		if status, err = a.httpStatusNow(); err == nil {
+			result.Status = &status
+		}
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.OK = true
+	}
+	return result
+}
+
+// batchHidden writes value to "Hidden" for a command of a POST /batch request once the changes scheduled for later
+// are cancelled (see CancelPendingChanges), so that neither a toggle waiting to be written nor the revert of
+// temporarily shown hidden files overwrites the result of the batch afterwards.
+//
+// Parameters:
+//
+//	value - The hidden files status to write.
+func (a *Application) batchHidden(value uint64) error {
+	a.Lib.CancelPendingChanges()
+	return a.setHidden(value, sourceHTTP)
+}
+
+// writeJSON writes v as the JSON body of a response with the given status code.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
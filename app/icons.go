@@ -0,0 +1,39 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import "fmt"
+
+// trayIconSizes lists the sizes, in pixels, of the tray icons embedded in trayIcons, in ascending order.
+// They cover display scaling from 100% (16 pixels) to 300% (48 pixels).
+var trayIconSizes = []uint32{16, 20, 24, 32, 48}
+
+// trayIcon returns the tray icon for the given status in the size that best matches the size of small icons at
+// the system DPI (16 pixels at defaultDPI): the smallest embedded size that is at least as large, so that the icon
+// is only ever scaled down, or the full-size icon if the DPI is higher than any embedded size accounts for.
+//
+// Parameters:
+//
+//	hidden - Whether hidden files are hidden (the icon for statusHidden) or visible.
+func trayIcon(hidden bool) []byte {
+	name, full := "ShowAllFiles1", icoVisible
+	if hidden {
+		name, full = "ShowAllFiles2", icoHidden
+	}
+
+	want := (16*systemDPI() + defaultDPI - 1) / defaultDPI
+	for _, size := range trayIconSizes {
+		if size < want {
+			continue
+		}
+		if b, err := trayIcons.ReadFile(fmt.Sprintf("icons/%s-%d.ico", name, size)); err == nil {
+			return b
+		}
+		break
+	}
+
+	return full
+}
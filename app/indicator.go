@@ -0,0 +1,231 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/kamaranl/winapi"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// indicatorClass is the window class of the indicator window shown with --indicator.
+	indicatorClass = "ShowAllFilesIndicator"
+
+	// Size of the indicator window and its distance from the top-right corner of the primary screen, at defaultDPI.
+	indicatorWidth  = 170
+	indicatorHeight = 30
+	indicatorMargin = 16
+
+	// indicatorAlpha is the opacity of the indicator window, from 0 (transparent) to 255 (opaque).
+	indicatorAlpha = 220
+
+	// Background colors (COLORREF, 0x00BBGGRR) of the indicator window while hidden files are shown or hidden.
+	indicatorShownColor  = 0x00307830
+	indicatorHiddenColor = 0x00404040
+
+	wsPopup          = 0x80000000
+	wsExTopmost      = 0x00000008
+	wsExTransparent  = 0x00000020
+	wsExToolWindow   = 0x00000080
+	wsExLayered      = 0x00080000
+	wsExNoActivate   = 0x08000000
+	swShowNoActivate = 4
+	smCxScreen       = 0
+	lwaAlpha         = 0x2
+	wmDestroy        = 0x0002
+	wmClose          = 0x0010
+	wmPaint          = 0x000F
+	dtCenter         = 0x01
+	dtVCenter        = 0x04
+	dtSingleLine     = 0x20
+	bkTransparent    = 1
+	defaultGUIFont   = 17
+	colorWhite       = 0x00FFFFFF
+)
+
+// wndClassEx mirrors the Win32 WNDCLASSEXW structure passed to RegisterClassExW.
+type wndClassEx struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     windows.Handle
+	hIcon         windows.Handle
+	hCursor       windows.Handle
+	hbrBackground windows.Handle
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       windows.Handle
+}
+
+// rect mirrors the Win32 RECT structure.
+type rect struct {
+	left, top, right, bottom int32
+}
+
+// paintStruct mirrors the Win32 PAINTSTRUCT structure passed to BeginPaint and EndPaint.
+type paintStruct struct {
+	hdc         windows.Handle
+	fErase      int32
+	rcPaint     rect
+	fRestore    int32
+	fIncUpdate  int32
+	rgbReserved [32]byte
+}
+
+// showIndicator starts a goroutine that shows a small, always-on-top, click-through window in the top-right corner
+// of the primary screen, telling whether hidden files are shown (--indicator), e.g., for viewers of a presentation.
+// The window is repainted whenever "status_hidden" changes (see state.Subscribe), and destroyed when the application
+// stops. Errors creating the window are sent to the application's error channel.
+func (a *Application) showIndicator() {
+	errCh := a.ErrCh
+	goSafe(a.Logger, "indicator window", 0, func() {
+		// the window belongs to, and is only served by the message loop of, the thread that creates it
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hwnd, instance, err := createIndicator()
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer unregisterIndicator(instance)
+
+		changes, cancel := state.Subscribe[uint64]("status_hidden")
+		goSafe(a.Logger, "indicator updater", 0, func() {
+			defer cancel()
+			for {
+				select {
+				case _, ok := <-changes:
+					if !ok {
+						return
+					}
+					_, _, _ = procInvalidateRect.Call(uintptr(hwnd), 0, 1)
+				case <-a.done:
+					if err := winapi.PostMessage(hwnd, wmClose, 0, 0); err != nil {
+						a.Logger.Warnf("Could not close the indicator window: %v", err)
+					}
+					return
+				}
+			}
+		})
+
+		var msg winapi.MSG
+		for {
+			if r1, err := winapi.GetMessage(msg, 0, 0, 0); r1 == 0 {
+				break
+			} else if int32(r1) == -1 {
+				errCh <- fmt.Errorf("failed call to GetMessage: %v", err)
+				break
+			}
+			_ = winapi.TranslateMessage(msg)
+			winapi.DispatchMessage(msg)
+		}
+		a.Logger.Debugf("Indicator window closed")
+	})
+}
+
+// createIndicator registers the window class of the indicator window and creates the window, scaled to the system
+// DPI, without activating it. It must be called on the thread that runs the window's message loop. Returns the window
+// and the module instance the class is registered for (see unregisterIndicator).
+func createIndicator() (winapi.HWND, windows.Handle, error) {
+	var instance windows.Handle
+	if err := windows.GetModuleHandleEx(0, nil, &instance); err != nil {
+		return 0, 0, fmt.Errorf("failed call to GetModuleHandleEx: %v", err)
+	}
+
+	class := windows.StringToUTF16Ptr(indicatorClass)
+	wc := wndClassEx{
+		lpfnWndProc:   windows.NewCallback(indicatorProc),
+		hInstance:     instance,
+		lpszClassName: class,
+	}
+	wc.cbSize = uint32(unsafe.Sizeof(wc))
+	if r1, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc))); r1 == 0 {
+		return 0, 0, fmt.Errorf("failed call to RegisterClassExW: %v", err)
+	}
+
+	dpi := int32(systemDPI())
+	width, height, margin := indicatorWidth*dpi/defaultDPI, indicatorHeight*dpi/defaultDPI, indicatorMargin*dpi/defaultDPI
+	screen, _, _ := procGetSystemMetrics.Call(smCxScreen)
+	hwnd, _, err := procCreateWindowExW.Call(
+		wsExTopmost|wsExTransparent|wsExToolWindow|wsExLayered|wsExNoActivate,
+		uintptr(unsafe.Pointer(class)),
+		0,
+		wsPopup,
+		uintptr(int32(screen)-width-margin), uintptr(margin), uintptr(width), uintptr(height),
+		0, 0, uintptr(instance), 0,
+	)
+	if hwnd == 0 {
+		unregisterIndicator(instance)
+		return 0, 0, fmt.Errorf("failed call to CreateWindowExW: %v", err)
+	}
+
+	_, _, _ = procSetLayeredWindowAttributes.Call(hwnd, 0, indicatorAlpha, lwaAlpha)
+	_, _, _ = procShowWindow.Call(hwnd, swShowNoActivate)
+
+	return winapi.HWND(hwnd), instance, nil
+}
+
+// unregisterIndicator unregisters the window class of the indicator window once the window is destroyed.
+func unregisterIndicator(instance windows.Handle) {
+	class := windows.StringToUTF16Ptr(indicatorClass)
+	_, _, _ = procUnregisterClassW.Call(uintptr(unsafe.Pointer(class)), uintptr(instance))
+}
+
+// indicatorProc is the window procedure of the indicator window. It paints the status of hidden files stored as
+// "status_hidden", and ends the message loop once the window is destroyed.
+func indicatorProc(hwnd uintptr, msg uint32, wParam, lParam uintptr) uintptr {
+	defer recoverCallback(log, "indicatorProc")
+
+	switch msg {
+	case wmPaint:
+		paintIndicator(hwnd)
+		return 0
+	case wmDestroy:
+		_, _, _ = procPostQuitMessage.Call(0)
+		return 0
+	}
+
+	r1, _, _ := procDefWindowProcW.Call(hwnd, uintptr(msg), wParam, lParam)
+	return r1
+}
+
+// paintIndicator fills the indicator window with the color for the status of hidden files and writes the status
+// on it in white.
+func paintIndicator(hwnd uintptr) {
+	var ps paintStruct
+	hdc, _, _ := procBeginPaint.Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+	if hdc == 0 {
+		return
+	}
+	defer func() { _, _, _ = procEndPaint.Call(hwnd, uintptr(unsafe.Pointer(&ps))) }()
+
+	text, color := "Hidden files: shown", uintptr(indicatorShownColor)
+	if hidden, _ := state.Get[uint64]("status_hidden"); hidden == statusHidden {
+		text, color = "Hidden files: hidden", indicatorHiddenColor
+	}
+
+	var r rect
+	_, _, _ = procGetClientRect.Call(hwnd, uintptr(unsafe.Pointer(&r)))
+	if brush, _, _ := procCreateSolidBrush.Call(color); brush != 0 {
+		_, _, _ = procFillRect.Call(hdc, uintptr(unsafe.Pointer(&r)), brush)
+		_, _, _ = procDeleteObject.Call(brush)
+	}
+
+	font, _, _ := procGetStockObject.Call(defaultGUIFont)
+	_, _, _ = procSelectObject.Call(hdc, font)
+	_, _, _ = procSetBkMode.Call(hdc, bkTransparent)
+	_, _, _ = procSetTextColor.Call(hdc, colorWhite)
+	_, _, _ = procDrawTextW.Call(hdc, uintptr(unsafe.Pointer(windows.StringToUTF16Ptr(text))), ^uintptr(0),
+		uintptr(unsafe.Pointer(&r)), dtCenter|dtVCenter|dtSingleLine)
+}
@@ -0,0 +1,2083 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/getlantern/systray"
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/kamaranl/winapi"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// API defines the interface for interacting with Windows Explorer and system registry.
+// It provides methods for retrieving registry key-value pairs, checking if a window is a file explorer,
+// posting refresh messages, refreshing explorer windows and the system tray, toggling hidden files visibility,
+// and watching for system messages and registry key changes. It also includes internal callback methods
+// for enumerating windows and handling Windows event hooks.
+// Application.Lib is typed as API so that alternative implementations can be substituted for the Library.
+type API interface {
+	CancelPendingChanges()
+	CopyToClipboard(text string) error
+	DiagnoseView(hwnd winapi.HWND) bool
+	ExplorerWindows() []winapi.HWND
+	GetKeyValuePair(closeKey bool) (key RegistryKey, value uint64, err error)
+	GetValue(name string) (uint64, error)
+	IsFileExplorer(hwnd winapi.HWND) bool
+	PostRefreshMessage(hwnd winapi.HWND)
+	RefreshExplorerWindows() int
+	RefreshExplorerWindowsContext(ctx context.Context) int
+	RedoToggle() error
+	RequestHidden(value uint64, source string) error
+	RequestToggle(source string) error
+	RefreshSystray()
+	Resync() error
+	SetHidden(value uint64) error
+	SetHiddenForSID(sid string, value uint64) error
+	SetValue(name string, value uint32) error
+	ShowTemporarily(d time.Duration) (<-chan struct{}, error)
+	ToggleHidden(source string)
+	ToggleSeparateProcess() error
+	UndoToggle() error
+	ViewSettings() (ViewSettings, error)
+	WaitForExplorer(ctx context.Context) <-chan winapi.HWND
+	WatchForegroundFolders()
+	WatchMessageLoop()
+	WatchReconcile(interval time.Duration)
+	WatchRegistryKey()
+	WatcherError() string
+	WatcherRunning() bool
+	enumWindowsProc(hwnd winapi.HWND, lParam uintptr) uintptr
+	winEventProc(evHook windows.Handle, ev uint32, hwnd winapi.HWND, objId, childId int32, evTId, evTime uint32) uintptr
+}
+
+var _ API = (*Library)(nil)
+
+// RegistryKey is the part of an open registry key that the Library uses to read and write the values under
+// Config.KeyPath. registry.Key implements it; tests substitute a fake through Library.OpenKey.
+type RegistryKey interface {
+	GetIntegerValue(name string) (val uint64, valtype uint32, err error)
+	GetStringValue(name string) (val string, valtype uint32, err error)
+	SetDWordValue(name string, value uint32) error
+	Close() error
+}
+
+var _ RegistryKey = registry.Key(0)
+
+// WindowAPI is the part of the Windows API that the Library uses to enumerate, identify, and refresh top-level
+// windows. By default, the Library calls Windows directly; tests and benchmarks substitute a fake through
+// Library.Windows.
+type WindowAPI interface {
+	// EnumWindows calls visit for each top-level window until it returns false.
+	EnumWindows(visit func(hwnd winapi.HWND) bool) error
+	// EnumChildWindows calls visit for each child window of hwnd (e.g., the tabs of File Explorer) until it
+	// returns false.
+	EnumChildWindows(hwnd winapi.HWND, visit func(child winapi.HWND) bool) error
+	ClassName(hwnd winapi.HWND) string
+	// Text returns the title of a window, or an empty string if it has none.
+	Text(hwnd winapi.HWND) string
+	Process(hwnd winapi.HWND) (pid uint32, exe string, err error)
+	PostMessage(hwnd winapi.HWND, msg uint32, wParam winapi.WPARAM, lParam winapi.LPARAM) error
+}
+
+// Library provides methods to interact with Windows File Explorer and system registry
+// to toggle the visibility of hidden files, update the systray UI, and handle system events.
+// It implements the API interface, which includes functions for registry access, window
+// enumeration, message posting, and event watching.
+//
+// Methods:
+//   - CancelPendingChanges: Cancels the changes of the hidden files setting scheduled for later.
+//   - CopyToClipboard: Places text on the Windows clipboard.
+//   - DiagnoseView: Logs whether a window can pick up the hidden files setting on its next refresh.
+//   - ExplorerWindows: Lists the handles of all open File Explorer windows without refreshing them.
+//   - GetKeyValuePair: Retrieves the registry key and value for hidden files setting.
+//   - GetValue: Retrieves the integer value of any property under the registry key.
+//   - IsFileExplorer: Determines if a window handle belongs to File Explorer.
+//   - PostRefreshMessage: Posts a refresh command to a File Explorer window.
+//   - RefreshExplorerWindows: Refreshes all open File Explorer windows.
+//   - RefreshExplorerWindowsContext: Refreshes all open File Explorer windows, stopping early if cancelled.
+//   - RedoToggle: Writes the value of the last undone toggle again.
+//   - RequestHidden: Sets the hidden files setting to a given status like a toggle.
+//   - RequestToggle: Toggles the hidden files setting like ToggleHidden, returning why a toggle was refused.
+//   - RefreshSystray: Updates the systray icon and menu based on hidden files status.
+//   - Resync: Re-reads the hidden files setting and refreshes the systray and all windows unconditionally.
+//   - SetHidden: Writes a specific hidden files status to the registry.
+//   - SetHiddenForSID: Writes a hidden files status to the registry of another user, e.g., in another session.
+//   - SetValue: Writes a DWORD value for any property under the registry key.
+//   - ShowTemporarily: Shows hidden files and reverts the setting after a delay.
+//   - ToggleHidden: Toggles the hidden files setting in the registry.
+//   - ToggleSeparateProcess: Toggles launching folder windows in a separate process.
+//   - UndoToggle: Reverts the last committed toggle.
+//   - ViewSettings: Reads the view-related values (Hidden, HideFileExt, ShowSuperHidden) at once.
+//   - WaitForExplorer: Signals when the next File Explorer window is brought to the foreground.
+//   - WatchForegroundFolders: Shows hidden files while a folder listed with --show-in-folder is in the foreground.
+//   - WatchMessageLoop: Refreshes the next File Explorer window brought to the foreground.
+//   - WatchReconcile: Periodically re-reads the hidden files setting to catch missed changes.
+//   - WatchRegistryKey: Watches for changes to the registry key controlling hidden files.
+//   - WatcherError: Returns the last error of the registry watcher.
+//   - WatcherRunning: Reports whether the registry watcher is running.
+//   - enumWindowsProc: Callback for enumerating windows and posting refresh messages.
+//   - winEventProc: Callback for handling system foreground events and refreshing Explorer.
+//
+// A *Library is the default API implementation assigned to Application.Lib by New. It reads its settings from
+// App.Config and logs through App.Logger. Values are read and written through OpenKey, which opens Config.KeyPath
+// under HKEY_CURRENT_USER (or under HKEY_USERS\<Config.UserSID>, see userKey) when nil. Likewise, top-level windows
+// are enumerated, identified, and refreshed through Windows, which calls the Windows API directly when nil.
+// The Library type is designed for use in a Windows environment and relies on
+// Windows API calls, registry access, and systray integration.
+type Library struct {
+	App     *Application
+	OpenKey func(access uint32) (RegistryKey, error)
+	Windows WindowAPI
+	mu      sync.Mutex
+
+	refreshCancel context.CancelFunc
+	enumCallback  uintptr
+	enumOnce      sync.Once
+	childCallback uintptr
+	childOnce     sync.Once
+	eventCallback uintptr
+	eventOnce     sync.Once
+	waitCancel    context.CancelFunc
+	waiters       map[windows.Handle]chan<- winapi.HWND
+
+	foreground     chan winapi.HWND
+	foregroundCall uintptr
+	foregroundOnce sync.Once
+
+	warns rateLimiter
+
+	broadcast atomic.Int32 // broadcastIdle, broadcastRunning, or broadcastQueued (see broadcastSettingChange)
+
+	toggleMu     sync.Mutex
+	toggleTimer  *time.Timer
+	toggleSeq    uint64 // identifies the toggleTimer that commitToggle may write for (see cancelToggle)
+	toggleValue  uint64
+	toggleSource string
+	history      toggleHistory
+}
+
+// States of the broadcast of WM_SETTINGCHANGE (see broadcastSettingChange): none in progress, one in progress, and
+// one in progress with another one queued to follow it.
+const (
+	broadcastIdle int32 = iota
+	broadcastRunning
+	broadcastQueued
+)
+
+// settingChangeTimeout is how long the broadcast of WM_SETTINGCHANGE waits for each window (see broadcastSettingChange).
+const settingChangeTimeout = 500 * time.Millisecond
+
+// defaultPollInterval is the default of --poll-interval, i.e., how often the registry is re-read with
+// --watch-mode=poll (see watchRegistryPoll).
+const defaultPollInterval = 2 * time.Second
+
+// defaultSettleDelay is the default of --settle-delay (see settle).
+const defaultSettleDelay = 50 * time.Millisecond
+
+// defaultWatchDebounce is the default of --watch-debounce, i.e., how long ToggleHidden waits for further toggles
+// before writing the registry, so that rapid toggles (e.g., mashing the hotkey) result in a single write of the net
+// effect.
+const defaultWatchDebounce = 250 * time.Millisecond
+
+// errReadOnly is returned when the "Hidden" value would be written with --read-only.
+var errReadOnly = errors.New("toggling is disabled (--read-only)")
+
+// errPolicyOverride is returned when the "Hidden" value would be written shortly after a policy was found to override
+// the setting (see checkPolicyOverride).
+var errPolicyOverride = errors.New("the setting appears to be enforced by a policy")
+
+// ownWriteWindow is how long the registry watcher ignores the change notification for a value written by a toggle,
+// which refreshes File Explorer windows itself (see writeToggle).
+const ownWriteWindow = 2 * time.Second
+
+// notifyWindow returns how long the change notification for a write may take to arrive: ownWriteWindow, plus
+// --poll-interval with --watch-mode=poll.
+func (c Config) notifyWindow() time.Duration {
+	if c.WatchMode == watchPoll {
+		return ownWriteWindow + c.PollInterval
+	}
+
+	return ownWriteWindow
+}
+
+// refreshSuspended reports whether refreshing File Explorer windows after a change of "Hidden" is suspended
+// ("refresh_suspended" in the state), as while a POST /batch request runs (see handleBatch), which leaves refreshing
+// them to its "refresh" command.
+func refreshSuspended() bool {
+	suspended, _ := state.Get[bool]("refresh_suspended")
+	return suspended
+}
+
+// enumState is passed to enumWindowsProc through EnumWindows' lParam.
+// It carries the context that cancels the enumeration and counts the File Explorer windows found.
+// When visit is set, it is called for every window (reporting whether it is a File Explorer window)
+// instead of anything being refreshed. Windows in handled were already refreshed through COM and are only counted.
+type enumState struct {
+	ctx     context.Context
+	found   uint32
+	visit   func(hwnd winapi.HWND, explorer bool)
+	handled map[winapi.HWND]bool
+}
+
+// CopyToClipboard replaces the contents of the Windows clipboard with the given text.
+// Opening the clipboard is retried briefly since another application may be holding it.
+// Returns an error if any of the clipboard or memory operations fail.
+//
+// Parameters:
+//
+//	text - The text to place on the clipboard.
+func (l *Library) CopyToClipboard(text string) error {
+	textW, err := windows.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	size := uintptr(len(textW)) * unsafe.Sizeof(textW[0])
+
+	for attempt := 0; ; attempt++ {
+		r1, _, err := procOpenClipboard.Call(0)
+		if r1 != 0 {
+			break
+		}
+		if attempt == 4 {
+			return fmt.Errorf("failed call to OpenClipboard: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer func() { _, _, _ = procCloseClipboard.Call() }()
+
+	if r1, _, err := procEmptyClipboard.Call(); r1 == 0 {
+		return fmt.Errorf("failed call to EmptyClipboard: %v", err)
+	}
+
+	hMem, _, err := procGlobalAlloc.Call(gmemMoveable, size)
+	if hMem == 0 {
+		return fmt.Errorf("failed call to GlobalAlloc: %v", err)
+	}
+	ptr, _, err := procGlobalLock.Call(hMem)
+	if ptr == 0 {
+		_, _, _ = procGlobalFree.Call(hMem)
+		return fmt.Errorf("failed call to GlobalLock: %v", err)
+	}
+	_, _, _ = procRtlMoveMemory.Call(ptr, uintptr(unsafe.Pointer(&textW[0])), size)
+	_, _, _ = procGlobalUnlock.Call(hMem)
+
+	l.App.Logger.Debugf("Setting clipboard data")
+	if r1, _, err := procSetClipboardData.Call(cfUnicodeText, hMem); r1 == 0 {
+		_, _, _ = procGlobalFree.Call(hMem)
+		return fmt.Errorf("failed call to SetClipboardData: %v", err)
+	}
+
+	return nil
+}
+
+// DiagnoseView logs, for diagnostics, what to expect of the folder view of the specified window after toggling, to
+// help explain why a particular window did not visually change. The setting itself is global, so a window only
+// cannot pick it up when it is not a File Explorer window or has stopped responding and therefore cannot process a
+// refresh; otherwise, the value it shows after its next refresh is logged, along with the caveat that virtual folders
+// (e.g., search results) may keep a cached view. The view itself is not inspected, so this does not verify that the
+// window actually shows hidden files accordingly.
+// Returns whether the window can pick up the setting on its next refresh.
+//
+// Parameters:
+//
+//	hwnd - The window handle of the File Explorer window to inspect.
+func (l *Library) DiagnoseView(hwnd winapi.HWND) bool {
+	title := l.windowTitle(hwnd)
+	if !l.IsFileExplorer(hwnd) {
+		l.App.Logger.Infof("Window %d (%q) is not a File Explorer window and is not refreshed", hwnd, title)
+		return false
+	}
+	if isHungAppWindow(hwnd) {
+		l.App.Logger.Infof("Window %d (%q) is not responding and cannot refresh its view until it recovers", hwnd, title)
+		return false
+	}
+
+	_, value, err := l.GetKeyValuePair(true)
+	if err != nil {
+		l.App.Logger.Warnf("Could not read the setting to expect in window %d (%q): %v", hwnd, title, err)
+		return false
+	}
+
+	visibility := "hidden"
+	if value == statusVisible {
+		visibility = "visible"
+	}
+	l.App.Logger.Infof("Window %d (%q) is expected to show hidden files as %s after its next refresh (not verified); "+
+		"virtual folders (e.g., search results, Libraries, Home) may keep a cached view until reopened",
+		hwnd, title, visibility)
+
+	return true
+}
+
+// ExplorerWindows enumerates the top-level windows and returns the handles of all File Explorer windows
+// (as determined by IsFileExplorer), without refreshing them. Returns nil if the enumeration fails.
+func (l *Library) ExplorerWindows() []winapi.HWND {
+	var hwnds []winapi.HWND
+	err := l.visitWindows(func(hwnd winapi.HWND, explorer bool) {
+		if explorer {
+			hwnds = append(hwnds, hwnd)
+		}
+	})
+	if err != nil {
+		l.App.Logger.Warnf("Could not enumerate all available windows: %v", err)
+		return nil
+	}
+
+	return hwnds
+}
+
+// visitWindows enumerates the top-level windows with enumWindowsProc, calling visit for each of them along with
+// whether it is a File Explorer window, without refreshing anything. Returns an error if the enumeration fails.
+func (l *Library) visitWindows(visit func(hwnd winapi.HWND, explorer bool)) error {
+	enum := enumState{ctx: context.Background(), visit: visit}
+	return l.enumWindows(&enum)
+}
+
+// enumWindows enumerates the top-level windows through Windows, if set, or EnumWindows otherwise, passing each of
+// them to visitWindow along with enum. Returns an error if the enumeration fails.
+func (l *Library) enumWindows(enum *enumState) error {
+	if l.Windows != nil {
+		return l.Windows.EnumWindows(func(hwnd winapi.HWND) bool {
+			return l.visitWindow(enum, hwnd)
+		})
+	}
+
+	id := callbackParams.add(enum)
+	defer callbackParams.remove(id)
+	if r1, _, err := procEnumWindows.Call(l.enumWindowsCallback(), id); r1 == 0 && enum.ctx.Err() == nil {
+		return fmt.Errorf("failed call to EnumWindows: %v", err)
+	}
+
+	return nil
+}
+
+// callbackParams holds the values passed to enumWindowsProc and childWindowsProc. Each enumeration passes the ID of
+// its value as lParam rather than a pointer to it, since a uintptr must not be converted back to a Go pointer.
+var callbackParams = callbackRegistry{values: map[uintptr]any{}}
+
+// callbackRegistry maps IDs, which can be passed through a uintptr to a callback, to the values they stand for.
+type callbackRegistry struct {
+	mu     sync.Mutex
+	last   uintptr
+	values map[uintptr]any
+}
+
+// add registers value and returns its ID, which must be removed once the callbacks are done with it.
+func (r *callbackRegistry) add(value any) uintptr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.last++
+	r.values[r.last] = value
+	return r.last
+}
+
+// get returns the value registered with the given ID, or nil if there is none.
+func (r *callbackRegistry) get(id uintptr) any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.values[id]
+}
+
+// remove unregisters the value with the given ID.
+func (r *callbackRegistry) remove(id uintptr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.values, id)
+}
+
+// windowClass returns the class name of the specified window through Windows, if set (see className).
+func (l *Library) windowClass(hwnd winapi.HWND) string {
+	if l.Windows != nil {
+		return l.Windows.ClassName(hwnd)
+	}
+
+	return className(hwnd)
+}
+
+// childWindows returns the child windows of the specified window through Windows, if set, or EnumChildWindows
+// otherwise (see childWindowsProc and callbackParams).
+func (l *Library) childWindows(hwnd winapi.HWND) []winapi.HWND {
+	var children []winapi.HWND
+	if l.Windows != nil {
+		_ = l.Windows.EnumChildWindows(hwnd, func(child winapi.HWND) bool {
+			children = append(children, child)
+			return true
+		})
+		return children
+	}
+
+	id := callbackParams.add(&children)
+	defer callbackParams.remove(id)
+	_, _, _ = procEnumChildWindows.Call(uintptr(hwnd), l.childWindowsCallback(), id)
+	return children
+}
+
+// windowTitle returns the title of the specified window through Windows, if set (see windowText).
+func (l *Library) windowTitle(hwnd winapi.HWND) string {
+	if l.Windows != nil {
+		return l.Windows.Text(hwnd)
+	}
+
+	return windowText(hwnd)
+}
+
+// describeWindow returns the handle of the specified window followed by its title (see windowTitle), which for File
+// Explorer is the name or full path of the folder it shows. Only the handle is returned if the window has no title.
+func (l *Library) describeWindow(hwnd winapi.HWND) string {
+	if title := l.windowTitle(hwnd); title != "" {
+		return fmt.Sprintf("%d (%q)", hwnd, title)
+	}
+
+	return fmt.Sprintf("%d", hwnd)
+}
+
+// windowOwner returns the process ID and executable path of the specified window through Windows, if set
+// (see windowProcess).
+func (l *Library) windowOwner(hwnd winapi.HWND) (pid uint32, exe string, err error) {
+	if l.Windows != nil {
+		return l.Windows.Process(hwnd)
+	}
+
+	return windowProcess(hwnd)
+}
+
+// postMessage posts a message to the specified window through Windows, if set, or PostMessage otherwise.
+func (l *Library) postMessage(hwnd winapi.HWND, msg uint32, wParam winapi.WPARAM, lParam winapi.LPARAM) error {
+	if l.Windows != nil {
+		return l.Windows.PostMessage(hwnd, msg, wParam, lParam)
+	}
+
+	return winapi.PostMessage(hwnd, msg, wParam, lParam)
+}
+
+// GetKeyValuePair opens the registry key at Config.KeyPath (see openKey) and retrieves the value of the "Hidden" entry.
+// If closeKey is true, the registry key will be closed before the function returns.
+// It returns the opened registry key, the value of "Hidden" as a uint64, and an error if any operation fails, in
+// which case the key is closed either way. A value stored as a string rather than a DWORD is parsed (see readHidden)
+// and normalized by writing it back as a DWORD, unless --read-only is set, rather than failing startup.
+func (l *Library) GetKeyValuePair(closeKey bool) (key RegistryKey, value uint64, err error) {
+	l.App.Logger.Debugf("Opening registry key %q", l.App.Config.KeyPath)
+	key, err = l.openKey(registry.SET_VALUE | registry.QUERY_VALUE)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed call to OpenKey: %v", err)
+	}
+	if closeKey {
+		defer func() { _ = key.Close() }()
+	}
+
+	value, isString, err := l.readHidden(key)
+	if err != nil {
+		if !closeKey {
+			_ = key.Close()
+		}
+		return nil, 0, fmt.Errorf("failed call to GetIntegerValue: %v", err)
+	}
+	if isString && !l.App.Config.ReadOnly {
+		if err = key.SetDWordValue("Hidden", uint32(value)); err != nil {
+			l.App.Logger.Warnf("Could not normalize 'Hidden' to a DWORD: %v", err)
+		} else {
+			l.App.Logger.Infof("Normalized 'Hidden' to a DWORD of %d", value)
+		}
+	}
+
+	return key, value, nil
+}
+
+// readHidden reads "Hidden" from key as a DWORD or, as found on some corrupted or third-party-modified profiles,
+// as a string (REG_SZ, e.g., "2"), which is parsed. Reports whether the value is stored as a string, so that the
+// caller can normalize it (see GetKeyValuePair). Returns an error if the value cannot be read, wrapping
+// registry.ErrNotExist if it does not exist, or if a string is not one of statusVisible or statusHidden.
+//
+// Parameters:
+//
+//	key - The open registry key holding "Hidden", with QUERY_VALUE access.
+func (l *Library) readHidden(key RegistryKey) (value uint64, isString bool, err error) {
+	l.App.Logger.Debugf("Getting integer value of property 'Hidden'")
+	value, _, err = key.GetIntegerValue("Hidden")
+	if !errors.Is(err, registry.ErrUnexpectedType) {
+		return value, false, err
+	}
+
+	raw, _, err := key.GetStringValue("Hidden")
+	if err != nil {
+		return 0, false, fmt.Errorf("failed call to GetStringValue: %w", err)
+	}
+	value, err = strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+	if err != nil || value != statusVisible && value != statusHidden {
+		return 0, false, fmt.Errorf("invalid string value %q of 'Hidden'", raw)
+	}
+	l.App.Logger.Warnf("'Hidden' is stored as a string (%q) rather than a DWORD", raw)
+
+	return value, true, nil
+}
+
+// openKey opens the registry key at Config.KeyPath with the given access rights through OpenKey, if set,
+// or directly in the registry of the user otherwise (see userKey). The caller must close the returned key.
+//
+// Parameters:
+//
+//	access - The access rights to open the key with (e.g., registry.QUERY_VALUE).
+func (l *Library) openKey(access uint32) (RegistryKey, error) {
+	if l.OpenKey != nil {
+		return l.OpenKey(access)
+	}
+
+	root, path := l.userKey(l.App.Config.KeyPath)
+	return registry.OpenKey(root, path, access)
+}
+
+// userKey returns the root key and the path of the registry key at path in the registry of the user whose setting
+// is toggled: under HKEY_USERS in the hive of Config.UserSID if set (e.g., by the service, see watchConsoleUser),
+// and under HKEY_CURRENT_USER otherwise.
+//
+// Parameters:
+//
+//	path - The path of the key relative to HKEY_CURRENT_USER.
+func (l *Library) userKey(path string) (registry.Key, string) {
+	if l.App.Config.UserSID == "" {
+		return registry.CURRENT_USER, path
+	}
+
+	return registry.USERS, l.App.Config.UserSID + `\` + path
+}
+
+// GetValue opens the Windows registry key at the specified path and retrieves the integer value of the named property.
+// If the property does not exist, the returned error wraps registry.ErrNotExist. "Hidden" stored as a string is
+// parsed (see readHidden), but left for GetKeyValuePair to normalize.
+//
+// Parameters:
+//
+//	name - The name of the registry value to read (e.g., "HideFileExt").
+func (l *Library) GetValue(name string) (uint64, error) {
+	key, err := l.openKey(registry.QUERY_VALUE)
+	if err != nil {
+		return 0, fmt.Errorf("failed call to OpenKey: %v", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	if name == "Hidden" {
+		value, _, err := l.readHidden(key)
+		if err != nil {
+			return 0, fmt.Errorf("failed call to GetIntegerValue: %w", err)
+		}
+		return value, nil
+	}
+
+	l.App.Logger.Debugf("Getting integer value of property %q", name)
+	value, _, err := key.GetIntegerValue(name)
+	if err != nil {
+		return 0, fmt.Errorf("failed call to GetIntegerValue: %w", err)
+	}
+
+	return value, nil
+}
+
+// ViewSettings is a snapshot of the values under Config.KeyPath that control which files File Explorer shows,
+// as returned by Library.ViewSettings.
+type ViewSettings struct {
+	Hidden          uint64 `json:"hidden"`            // statusVisible (1) or statusHidden (2)
+	HideFileExt     uint64 `json:"hide_file_ext"`     // 1 if extensions of known file types are hidden
+	ShowSuperHidden uint64 `json:"show_super_hidden"` // 1 if protected operating system files are shown
+}
+
+// viewSettingDefaults are the values Windows assumes for the ViewSettings that are not set in the registry.
+var viewSettingDefaults = ViewSettings{Hidden: statusHidden, HideFileExt: 1, ShowSuperHidden: 0}
+
+// ViewSettings opens the registry key once and reads "Hidden", "HideFileExt", and "ShowSuperHidden" from it, which
+// gives a coherent snapshot for status reports. Values that do not exist are reported as the Windows defaults (see
+// viewSettingDefaults), and "Hidden" stored as a string is parsed (see readHidden). Returns an error if the key cannot
+// be opened or a value cannot be read.
+func (l *Library) ViewSettings() (ViewSettings, error) {
+	key, err := l.openKey(registry.QUERY_VALUE)
+	if err != nil {
+		return ViewSettings{}, fmt.Errorf("failed call to OpenKey: %v", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	settings := viewSettingDefaults
+	for name, value := range map[string]*uint64{
+		"Hidden":          &settings.Hidden,
+		"HideFileExt":     &settings.HideFileExt,
+		"ShowSuperHidden": &settings.ShowSuperHidden,
+	} {
+		var v uint64
+		if name == "Hidden" {
+			v, _, err = l.readHidden(key)
+		} else {
+			v, _, err = key.GetIntegerValue(name)
+		}
+		if errors.Is(err, registry.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return ViewSettings{}, fmt.Errorf("failed call to GetIntegerValue for %q: %w", name, err)
+		}
+		*value = v
+	}
+
+	return settings, nil
+}
+
+// IsFileExplorer determines whether the specified window handle (hwnd) belongs to a Windows File Explorer window.
+// It checks the window class name for "CabinetWClass" and verifies that the associated process executable is
+// "explorer.exe" in the Windows directory, or one of its 32-bit copies (see explorerPaths).
+// Returns true if both conditions are met, indicating the window is a File Explorer; otherwise, returns false.
+// If the process cannot be queried because it runs elevated (while this one does not), the window is only assumed
+// to be a File Explorer if --refresh-unverified is set, since any process can create a window with that class.
+//
+// Parameters:
+//
+//	hwnd - The window handle to test for a File Explorer window.
+func (l *Library) IsFileExplorer(hwnd winapi.HWND) bool {
+	if !strings.EqualFold(l.windowClass(hwnd), "CabinetWClass") {
+		return false
+	}
+	l.App.Logger.Debugf("Found window with class 'CabinetWClass'")
+
+	_, exeName, err := l.windowOwner(hwnd)
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) && l.App.Config.RefreshUnverified {
+		l.App.Logger.Debugf("Could not confirm the process of window %d (e.g., an elevated Explorer); assuming File Explorer", hwnd)
+		return true
+	}
+	if err != nil {
+		return false
+	}
+
+	for _, procName := range explorerPaths() {
+		if strings.EqualFold(exeName, procName) {
+			l.App.Logger.Debugf("Found window for explorer.exe")
+			return true
+		}
+	}
+	l.App.Logger.Debugf("Window %d belongs to %q, not to explorer.exe", hwnd, exeName)
+	return false
+}
+
+// isRefreshClass reports whether the class name of the specified window was listed with --refresh-class.
+func (l *Library) isRefreshClass(hwnd winapi.HWND) bool {
+	if len(l.App.Config.RefreshClasses) == 0 {
+		return false
+	}
+
+	name := l.windowClass(hwnd)
+	for _, class := range l.App.Config.RefreshClasses {
+		if strings.EqualFold(name, class) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// postRefreshKey posts an F5 key press to the specified window handle (hwnd), which is how most
+// third-party file managers refresh their view. If posting the message fails, a rate-limited warning is logged.
+func (l *Library) postRefreshKey(hwnd winapi.HWND) {
+	l.App.Logger.Debugf("Posting F5 key press to window handle %s", l.describeWindow(hwnd))
+	err := l.postMessage(hwnd, wmKeyDown, winapi.WPARAM(windows.VK_F5), 0)
+	if err == nil {
+		err = l.postMessage(hwnd, wmKeyUp, winapi.WPARAM(windows.VK_F5), 0)
+	}
+	if err != nil {
+		l.warns.Warnf(l.App.Logger, "Could not post F5 key press to window handle %d: %v", hwnd, err)
+	}
+}
+
+// PostRefreshMessage posts a refresh command message to the specified window handle (hwnd).
+// It sends a WM_COMMAND message with a predefined refresh identifier to trigger a refresh action
+// in the target window. On builds of Windows 11 where File Explorer has tabs (see hasExplorerTabs), each tab
+// is a separate child window that only refreshes its own view, so the message is also posted to every tab.
+// The debug log identifies the window by its title (i.e., the folder it shows), if any. If posting the
+// message fails, a warning is logged (at most once per warnInterval for the same window and error).
+//
+// Parameters:
+//
+//	hwnd - The window handle to which the refresh message will be posted.
+func (l *Library) PostRefreshMessage(hwnd winapi.HWND) {
+	l.App.Logger.Debugf("Posting refresh message to window handle %s", l.describeWindow(hwnd))
+	if err := l.postMessage(hwnd, winapi.WM_COMMAND, winapi.WPARAM(41504), 0); err != nil {
+		l.warns.Warnf(l.App.Logger, "Could not post refresh message to window handle %d: %v", hwnd, err)
+		return
+	}
+
+	if !hasExplorerTabs() {
+		return
+	}
+	for _, tab := range l.childWindows(hwnd) {
+		if l.windowClass(tab) != explorerTabClass {
+			continue
+		}
+		l.App.Logger.Debugf("Posting refresh message to tab %d of window handle %s", tab, l.describeWindow(hwnd))
+		if err := l.postMessage(tab, winapi.WM_COMMAND, winapi.WPARAM(41504), 0); err != nil {
+			l.warns.Warnf(l.App.Logger, "Could not post refresh message to tab %d of window handle %d: %v", tab, hwnd, err)
+		}
+	}
+}
+
+// RefreshExplorerWindows refreshes all currently open File Explorer windows.
+// It is equivalent to RefreshExplorerWindowsContext with a background context.
+func (l *Library) RefreshExplorerWindows() int {
+	return l.RefreshExplorerWindowsContext(context.Background())
+}
+
+// RefreshExplorerWindowsContext refreshes all currently open File Explorer windows and returns how many were found.
+// It does not wait for windows to be opened; callers that want the next window to be refreshed when none is
+// currently open use WatchMessageLoop (or WaitForExplorer). Logs warnings if window enumeration fails.
+// With --refresh-mode=com, the windows are first refreshed through COM (see refreshShellWindows), and refresh
+// messages are only posted to the windows that could not be.
+//
+// Concurrency model: the window enumeration runs without holding the lock, so a concurrent toggle is never
+// blocked by a slow enumeration. Starting a refresh cancels any refresh still in progress, since the newer one
+// supersedes it; enumWindowsProc stops enumerating as soon as its context is cancelled (either by ctx or by a newer
+// refresh).
+//
+// Parameters:
+//
+//	ctx - Cancels the enumeration when done.
+func (l *Library) RefreshExplorerWindowsContext(ctx context.Context) int {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	l.mu.Lock()
+	if l.refreshCancel != nil {
+		l.refreshCancel()
+	}
+	l.refreshCancel = cancel
+	l.mu.Unlock()
+
+	enum := enumState{ctx: ctx}
+	if l.App.Config.RefreshMode == refreshCOM {
+		handled, err := l.refreshShellWindows(ctx)
+		if err != nil {
+			l.warns.Warnf(l.App.Logger, "Could not refresh all File Explorer windows through COM, posting messages instead: %v", err)
+		}
+		enum.handled = handled
+	}
+
+	l.App.Logger.Debugf("Enumerating all available windows")
+	err := l.enumWindows(&enum)
+	if ctx.Err() != nil {
+		l.App.Logger.Debugf("Window enumeration cancelled")
+	} else if err != nil {
+		l.App.Logger.Warnf("Could not enumerate all available windows: %v", err)
+	}
+
+	return int(enum.found)
+}
+
+// settle waits for d (--settle-delay) after "Hidden" was written and before File Explorer windows are refreshed,
+// since on some systems Explorer has not picked up the new value yet when refreshed right away, so that its windows
+// keep showing the old state until toggled again. Nothing is done if d is 0.
+//
+// Parameters:
+//
+//	logger - Receives a debug message about the wait.
+//	d      - How long to wait.
+func settle(logger Logger, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	logger.Debugf("Waiting %s for the change to settle before refreshing", d)
+	time.Sleep(d)
+}
+
+// refreshOrWatch refreshes all currently open File Explorer windows or, if none is open,
+// refreshes the next one brought to the foreground (see WatchMessageLoop). It also notifies the rest of the shell
+// (see broadcastSettingChange).
+func (l *Library) refreshOrWatch() {
+	l.broadcastSettingChange()
+	if l.RefreshExplorerWindows() == 0 {
+		l.App.Logger.Debugf("File Explorer not currently open")
+		l.WatchMessageLoop()
+	}
+}
+
+// menuToggle returns the toggle menu item stored as "menu_toggle" in the state. A warning is logged if it is missing
+// even though the tray menu was built with it, which indicates a bug; it is legitimately missing before the menu is
+// built and when left out with --menu.
+func (l *Library) menuToggle() (*systray.MenuItem, bool) {
+	toggle, ok := state.Get[*systray.MenuItem]("menu_toggle")
+	if !ok && slices.Contains(l.App.menu, menuToggle) {
+		l.App.Logger.Warnf("Could not get state for 'menu_toggle': not set")
+	}
+
+	return toggle, ok
+}
+
+// systrayHidden returns the "Hidden" value stored as "status_hidden" in the state. If it is missing (e.g., transiently
+// during startup or after the state was cleared), it is re-read from the registry and stored again, so that the tray
+// does not get stuck with a stale icon. Returns false, after logging the error, if it cannot be read.
+func (l *Library) systrayHidden() (uint64, bool) {
+	if hidden, ok := state.Get[uint64]("status_hidden"); ok {
+		return hidden, true
+	}
+
+	l.App.Logger.Debugf("State for 'status_hidden' not set; re-reading it from the registry")
+	hidden, err := l.GetValue("Hidden")
+	if err != nil {
+		l.App.Logger.Errorf("Could not recover state for 'status_hidden': %v", err)
+		return 0, false
+	}
+	state.Set("status_hidden", hidden)
+
+	return hidden, true
+}
+
+// broadcastSettingChange starts a goroutine that broadcasts the change of the hidden files setting to all top-level
+// windows (see the broadcastSettingChange function). This is how the desktop and other shell views that are not
+// File Explorer windows (and are therefore not refreshed) pick up the change. The broadcast runs in the background
+// since it may take up to settingChangeTimeout for every window, and a toggle must not wait for it. If a broadcast is
+// still in progress, another one is queued to follow it, since the one in progress may have reached some windows
+// before the change; further requests while one is queued are merged into it. A timed-out broadcast (e.g., because of
+// a hung window) is logged.
+func (l *Library) broadcastSettingChange() {
+	for {
+		switch current := l.broadcast.Load(); {
+		case current == broadcastQueued:
+			return
+		case current == broadcastRunning && l.broadcast.CompareAndSwap(broadcastRunning, broadcastQueued):
+			l.App.Logger.Debugf("Queueing setting change broadcast; a broadcast is still in progress")
+			return
+		case current == broadcastIdle && l.broadcast.CompareAndSwap(broadcastIdle, broadcastRunning):
+			goSafe(l.App.Logger, "setting change broadcast", 0, l.runBroadcasts)
+			return
+		}
+	}
+}
+
+// runBroadcasts broadcasts the setting change for broadcastSettingChange, followed by the queued broadcast, if any,
+// until none is queued anymore.
+func (l *Library) runBroadcasts() {
+	for {
+		err := broadcastSettingChange(settingChangeTimeout)
+		if errors.Is(err, windows.ERROR_TIMEOUT) {
+			l.App.Logger.Warnf("Broadcast of the setting change timed out after %s", settingChangeTimeout)
+		} else if err != nil {
+			l.App.Logger.Warnf("Could not broadcast the setting change: %v", err)
+		}
+
+		if l.broadcast.CompareAndSwap(broadcastRunning, broadcastIdle) {
+			return
+		}
+		// only this goroutine leaves broadcastQueued, so the queued broadcast can be taken over as is
+		l.broadcast.Store(broadcastRunning)
+		l.App.Logger.Debugf("Broadcasting queued setting change")
+	}
+}
+
+// refreshChanged refreshes the windows after "Hidden" changed: only the foreground window with
+// --refresh-foreground-only (see refreshForeground), or else all of them (see refreshOrWatch). If the foreground
+// window is not File Explorer, the next File Explorer window brought to the foreground is refreshed instead.
+func (l *Library) refreshChanged() {
+	if !l.App.Config.RefreshForegroundOnly {
+		l.refreshOrWatch()
+		return
+	}
+
+	l.broadcastSettingChange()
+	if l.refreshForeground() == 0 {
+		l.App.Logger.Debugf("Foreground window is not File Explorer")
+		l.WatchMessageLoop()
+	}
+}
+
+// refreshForeground refreshes only the foreground window (see foregroundWindow), without enumerating all windows, if
+// it is a File Explorer window (unless it shows a folder listed with --no-refresh-folder, see skipsRefresh) or a
+// window of a class listed with
+// --refresh-class. Refresh messages are always posted, regardless of --refresh-mode. Returns the number of File
+// Explorer windows found, i.e., 1 if the foreground window is one, and 0 otherwise.
+func (l *Library) refreshForeground() int {
+	hwnd := foregroundWindow()
+	switch {
+	case l.IsFileExplorer(hwnd):
+		if !l.skipsRefresh(hwnd) {
+			l.PostRefreshMessage(hwnd)
+		}
+		return 1
+	case l.isRefreshClass(hwnd):
+		l.postRefreshKey(hwnd)
+	}
+
+	return 0
+}
+
+// foregroundWindow returns the foreground window or, while the taskbar, the tray menu, or another window of this
+// process has the focus (see isTrayWindow), as after toggling from the tray menu, the window that was in the
+// foreground before the tray icon was used (see rememberForeground), if it still exists.
+func foregroundWindow() winapi.HWND {
+	hwnd := windows.GetForegroundWindow()
+	if !isTrayWindow(hwnd) {
+		return hwnd
+	}
+	if before, ok := state.Get[winapi.HWND]("tray_foreground"); ok && isWindow(before) {
+		return before
+	}
+
+	return hwnd
+}
+
+// RefreshSystray updates the systray menu and icon based on the application's hidden status. It retrieves the toggle
+// menu item and hidden status from the state, and adjusts the systray title, icon, and tooltip accordingly. Until
+// WatchRegistryKey reports "watcher_ready", the tooltip indicates that the application is still initializing, and once
+// the watcher stopped (see WatcherRunning), it says so; with --no-watch, it never mentions the watcher. The hotkey
+// ("hotkey_label") is appended to the tooltip while it is registered ("hotkey_registered"), or that it is unavailable
+// otherwise, followed by a line for each of the other view-related values (see viewTooltip). The "SeparateProcess" menu
+// item is checked according to "status_separateProcess", the "Undo" and "Redo" menu items are enabled according to the
+// toggle history, and the "Cancel auto-hide" menu item is only shown while a revert scheduled by ShowTemporarily is
+// pending. Menu items left out with --menu are skipped. A missing hidden status is recovered from the registry (see
+// systrayHidden), and only if that fails, the function returns early. Nothing is done when running without a system
+// tray (--no-tray, or as a service), or before onReady reported the tray as ready ("tray_ready"), since the systray
+// cannot be updated before systray.Run started it.
+func (l *Library) RefreshSystray() {
+	if l.App.Config.NoTray {
+		return
+	}
+	if ready, _ := state.Get[bool]("tray_ready"); !ready {
+		l.App.Logger.Debugf("Not refreshing the systray; it is not running")
+		return
+	}
+
+	l.App.Logger.Debugf("Refreshing systray")
+	toggle, hasToggle := l.menuToggle()
+	hidden, ok := l.systrayHidden()
+	if !ok {
+		return
+	}
+	temporary, hasTemporary := state.Get[*systray.MenuItem]("menu_temporary")
+	var tooltip string
+	if hidden == statusHidden {
+		if hasToggle {
+			toggle.SetTitle("Show")
+		}
+		systray.SetIcon(trayIcon(true))
+		tooltip = l.App.Meta.Name + " - Disabled"
+		if hasTemporary && !l.App.Config.ReadOnly {
+			temporary.Enable()
+		}
+	} else {
+		if hasToggle {
+			toggle.SetTitle("Hide")
+		}
+		systray.SetIcon(trayIcon(false))
+		tooltip = l.App.Meta.Name + " - Enabled"
+		if hasTemporary {
+			temporary.Disable()
+		}
+	}
+	// there is no watcher to wait for with --no-watch
+	if ready, _ := state.Get[bool]("watcher_ready"); !ready && !l.App.Config.NoWatch {
+		tooltip = l.App.Meta.Name + " - Initializing…"
+	} else if ready && !l.WatcherRunning() {
+		tooltip += " - Watcher stopped"
+	}
+	if registered, ok := state.Get[bool]("hotkey_registered"); ok {
+		if label, _ := state.Get[string]("hotkey_label"); registered {
+			tooltip += " (" + label + ")"
+		} else {
+			tooltip += " (hotkey unavailable)"
+		}
+	}
+	if l.App.Config.ReadOnly {
+		tooltip += " (read-only)"
+	}
+	if _, ok := state.Get[uint64](viewTooltipLines[0].key); !ok {
+		l.storeViewSettings()
+	}
+	systray.SetTooltip(tooltip + viewTooltip())
+
+	canUndo, canRedo := l.history.available()
+	for key, enable := range map[string]bool{"menu_undo": canUndo, "menu_redo": canRedo} {
+		if item, ok := state.Get[*systray.MenuItem](key); ok {
+			if enable && !l.App.Config.ReadOnly {
+				item.Enable()
+			} else {
+				item.Disable()
+			}
+		}
+	}
+	if item, ok := state.Get[*systray.MenuItem]("menu_cancelTemporary"); ok {
+		if slices.Contains(state.ActiveTimers(), "timer_temporary") {
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+	if item, ok := state.Get[*systray.MenuItem]("menu_separateProcess"); ok {
+		if separate, _ := state.Get[uint64]("status_separateProcess"); separate != 0 {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+	}
+}
+
+// Resync is the manual escape hatch for when the event-driven updates have drifted from the registry.
+// It force-reads the current "Hidden" value, stores it in the state, and refreshes the systray and
+// all File Explorer windows, regardless of whether the value appears to have changed.
+// Returns an error if the value cannot be read.
+func (l *Library) Resync() error {
+	_, value, err := l.GetKeyValuePair(true)
+	if err != nil {
+		return err
+	}
+
+	l.App.Logger.Infof("Manually resynced 'Hidden' value %d from the registry", value)
+	state.Set("status_hidden", value)
+	l.RefreshSystray()
+	l.refreshOrWatch()
+
+	return nil
+}
+
+// SetHidden writes the given status (statusVisible or statusHidden) to the "Hidden" registry value and updates the
+// application state and the systray, which would otherwise stay stale with --no-watch. The registry watcher then
+// refreshes the File Explorer windows; without it (--no-watch), they are refreshed right away unless --no-refresh is
+// set or refreshing is suspended (see refreshSuspended).
+// It returns an error if the registry key cannot be opened or written, or errReadOnly with --read-only.
+//
+// Parameters:
+//
+//	value - The hidden files status to write.
+func (l *Library) SetHidden(value uint64) error {
+	if l.App.Config.ReadOnly {
+		return errReadOnly
+	}
+	if err := l.SetValue("Hidden", uint32(value)); err != nil {
+		return err
+	}
+	if err := state.SetStrict("status_hidden", value); err != nil {
+		l.App.Logger.Warnf("Could not update state: %v", err)
+	}
+	l.RefreshSystray()
+	if l.App.Config.NoWatch && !l.App.Config.NoRefresh && !refreshSuspended() {
+		settle(l.App.Logger, l.App.Config.SettleDelay)
+		l.refreshChanged()
+	}
+
+	return nil
+}
+
+// SetHiddenForSID writes the given status (statusVisible or statusHidden) to the "Hidden" value under Config.KeyPath
+// in the registry hive of the user with the given SID (under HKEY_USERS), e.g., to mirror the setting into another
+// session on a terminal server. The setting is per user, so sessions of the same user share it, while those of other
+// users need this. Unlike SetHidden, the application state is left alone, and the other user's File Explorer windows
+// are not refreshed; an instance running in their session picks up the change through its registry watcher.
+// Writing to another user's hive requires administrator rights, and the hive is only loaded while the user is
+// signed in. Both cases are reported as distinct errors, wrapping ERROR_ACCESS_DENIED and registry.ErrNotExist.
+//
+// Parameters:
+//
+//	sid   - The security identifier of the user (e.g., "S-1-5-21-...-1001").
+//	value - The hidden files status to write.
+func (l *Library) SetHiddenForSID(sid string, value uint64) error {
+	if _, err := windows.StringToSid(sid); err != nil {
+		return fmt.Errorf("invalid SID %q: %v", sid, err)
+	}
+	if value != statusVisible && value != statusHidden {
+		return fmt.Errorf("invalid value %d for 'Hidden', expected %d or %d", value, statusVisible, statusHidden)
+	}
+
+	path := sid + `\` + l.App.Config.KeyPath
+	l.App.Logger.Debugf("Opening registry key %q under HKEY_USERS", path)
+	key, err := registry.OpenKey(registry.USERS, path, registry.SET_VALUE)
+	switch {
+	case errors.Is(err, windows.ERROR_ACCESS_DENIED):
+		return fmt.Errorf("access denied to the registry of %s; writing it requires administrator rights: %w", sid, err)
+	case errors.Is(err, registry.ErrNotExist):
+		return fmt.Errorf("registry of %s is not loaded; the user must be signed in: %w", sid, err)
+	case err != nil:
+		return fmt.Errorf("failed call to OpenKey: %v", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	if err = key.SetDWordValue("Hidden", uint32(value)); err != nil {
+		if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+			return fmt.Errorf("access denied to 'Hidden' in the registry of %s: %w", sid, err)
+		}
+		return fmt.Errorf("failed call to SetDWordValue: %v", err)
+	}
+	l.App.Logger.Infof("Set 'Hidden' value to %d for %s", value, sid)
+
+	return nil
+}
+
+// SetValue opens the Windows registry key at the specified path and writes a DWORD value for the named property.
+// It returns an error if the registry key cannot be opened or written.
+//
+// Parameters:
+//
+//	name  - The name of the registry value to write (e.g., "HideFileExt").
+//	value - The DWORD value to write.
+func (l *Library) SetValue(name string, value uint32) error {
+	key, err := l.openKey(registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("failed call to OpenKey: %v", err)
+	}
+	defer func() { _ = key.Close() }()
+
+	l.App.Logger.Debugf("Setting registry key value for property %q", name)
+	if err = key.SetDWordValue(name, value); err != nil {
+		return fmt.Errorf("failed call to SetDWordValue: %v", err)
+	}
+
+	return nil
+}
+
+// ShowTemporarily makes hidden files visible and schedules the setting to be reverted once d has elapsed.
+// The pending revert is tracked in the state under "timer_temporary" and is cancelled if the user toggles
+// in the meantime. A toggle still waiting to be written is cancelled before either write (see cancelToggle), so that
+// it does not overwrite them. The returned channel is closed after the revert has been performed.
+// If hidden files are already visible, nothing is scheduled and a nil channel is returned.
+//
+// Parameters:
+//
+//	d - How long hidden files remain visible before reverting.
+func (l *Library) ShowTemporarily(d time.Duration) (<-chan struct{}, error) {
+	l.cancelToggle()
+	_, value, err := l.GetKeyValuePair(true)
+	if err != nil {
+		return nil, err
+	}
+	if value != statusHidden {
+		l.App.Logger.Debugf("Hidden files are already visible; nothing to revert")
+		return nil, nil
+	}
+	if err = l.SetHidden(statusVisible); err != nil {
+		return nil, err
+	}
+
+	l.App.Logger.Infof("Showing hidden files for %s", d)
+	reverted := make(chan struct{})
+	state.SetTTL("timer_temporary", value, d, func() {
+		defer close(reverted)
+
+		l.App.Logger.Infof("Reverting temporarily shown hidden files")
+		l.cancelToggle()
+		if err := l.SetHidden(value); err != nil {
+			l.App.Logger.Errorf("Could not revert temporarily shown hidden files: %v", err)
+		}
+	})
+
+	return reverted, nil
+}
+
+// ToggleHidden toggles the hidden status in the registry and updates the application state.
+// It retrieves the current hidden status, switches it between visible and hidden, and sets the new state,
+// refreshing the systray immediately. The registry write itself is deferred by Config.WatchDebounce:
+// further toggles within that window flip the pending value and restart the timer, so only the net
+// effect is written once (see requestHidden and commitToggle).
+// Toggles are ignored for a while after a policy was found to override the setting (see checkPolicyOverride), and
+// always with --read-only.
+// If any error occurs during the process, it logs the error and returns; callers that must report why a toggle was
+// refused use RequestToggle instead.
+//
+// Parameters:
+//
+//	source - What triggered the toggle (e.g., sourceHotkey), as recorded in the audit log.
+func (l *Library) ToggleHidden(source string) {
+	err := l.RequestToggle(source)
+	switch {
+	case errors.Is(err, errReadOnly), errors.Is(err, errPolicyOverride):
+		l.App.Logger.Warnf("Ignoring toggle from %s; %v", source, err)
+	case err != nil:
+		l.App.Logger.Errorf("%v", err)
+	}
+}
+
+// RequestHidden sets the hidden status to value (statusVisible or statusHidden) the way ToggleHidden toggles it:
+// the state and systray are updated right away, and the registry write is coalesced with toggles and other requests
+// within Config.WatchDebounce, then audited, recorded in the history, and announced (see commitToggle).
+// Returns errReadOnly with --read-only, errPolicyOverride for a while after a policy was found to override the
+// setting, or an error if the current value cannot be read.
+//
+// Parameters:
+//
+//	value  - The hidden files status to set.
+//	source - What requested the change (e.g., sourceHTTP), as recorded in the audit log.
+func (l *Library) RequestHidden(value uint64, source string) error {
+	return l.requestHidden(source, func(uint64) uint64 { return value })
+}
+
+// RequestToggle toggles the hidden status like ToggleHidden, but returns the error instead of logging it: errReadOnly
+// with --read-only, errPolicyOverride for a while after a policy was found to override the setting, or an error if
+// the current value cannot be read.
+//
+// Parameters:
+//
+//	source - What requested the toggle (e.g., sourceHTTP), as recorded in the audit log.
+func (l *Library) RequestToggle(source string) error {
+	return l.requestHidden(source, func(value uint64) uint64 {
+		if value == statusHidden {
+			return statusVisible
+		}
+		return statusHidden
+	})
+}
+
+// requestHidden sets the pending value of "Hidden" to next applied to the pending value (or, if none is pending, the
+// value in the registry), updates the state and systray, and (re)starts the timer of Config.WatchDebounce after
+// which commitToggle writes it. Once the request is accepted, any pending revert scheduled by ShowTemporarily is
+// cancelled, as is the restore after leaving a folder listed with --show-in-folder (see WatchForegroundFolders).
+// Returns errReadOnly with --read-only, errPolicyOverride while policyCoolingDown, or an error if the value in the
+// registry cannot be read, leaving both pending.
+//
+// Parameters:
+//
+//	source - What requested the change, as recorded in the audit log.
+//	next   - Returns the value to write, given the pending one.
+func (l *Library) requestHidden(source string, next func(value uint64) uint64) error {
+	if l.App.Config.ReadOnly {
+		return errReadOnly
+	}
+
+	if policyCoolingDown() {
+		return errPolicyOverride
+	}
+
+	l.toggleMu.Lock()
+	defer l.toggleMu.Unlock()
+
+	if l.toggleTimer == nil {
+		value, err := l.GetValue("Hidden")
+		if err != nil {
+			return err
+		}
+		l.toggleValue = value
+	} else {
+		l.toggleTimer.Stop()
+		l.App.Logger.Debugf("Coalescing rapid toggle")
+	}
+
+	l.cancelScheduled()
+
+	l.toggleValue = next(l.toggleValue)
+	l.toggleSource = source
+	state.Set("status_source", source)
+	state.Set("status_hidden", l.toggleValue)
+	l.RefreshSystray()
+	l.toggleSeq++
+	seq := l.toggleSeq
+	l.toggleTimer = time.AfterFunc(l.App.Config.WatchDebounce, func() { l.commitToggle(seq) })
+
+	return nil
+}
+
+// CancelPendingChanges cancels the changes of "Hidden" scheduled for later, so that they do not overwrite a value
+// written directly (e.g., by POST /batch or ShowTemporarily): a toggle still waiting to be written (see
+// cancelToggle), the revert scheduled by ShowTemporarily, and the restore after leaving a folder listed with
+// --show-in-folder (see cancelScheduled).
+func (l *Library) CancelPendingChanges() {
+	l.cancelToggle()
+	l.cancelScheduled()
+}
+
+// cancelToggle stops a toggle still waiting to be written (see requestHidden). A commitToggle that already started
+// waiting for toggleMu is skipped as well, since it no longer matches toggleSeq. The state and systray, which showed
+// the pending value, are reset to the value stored in the registry.
+func (l *Library) cancelToggle() {
+	l.toggleMu.Lock()
+	defer l.toggleMu.Unlock()
+
+	if l.toggleTimer == nil {
+		return
+	}
+	l.toggleTimer.Stop()
+	l.toggleTimer = nil
+	l.toggleSeq++
+	state.Delete("status_source")
+	l.App.Logger.Debugf("Cancelled pending toggle to %d", l.toggleValue)
+	if value, err := l.GetValue("Hidden"); err == nil && value != l.toggleValue {
+		state.Set("status_hidden", value)
+		l.RefreshSystray()
+	}
+}
+
+// cancelScheduled cancels the revert of temporarily shown hidden files scheduled by ShowTemporarily
+// ("timer_temporary") and the restore after leaving a folder listed with --show-in-folder ("folder_rule").
+func (l *Library) cancelScheduled() {
+	if _, ok := state.Get[uint64]("timer_temporary"); ok {
+		l.App.Logger.Debugf("Cancelling pending revert of temporarily shown hidden files")
+		state.Delete("timer_temporary")
+	}
+	if _, ok := state.Get[uint64]("folder_rule"); ok {
+		l.App.Logger.Debugf("Cancelling restore of hidden files after leaving the folder")
+		state.Delete("folder_rule")
+	}
+}
+
+// commitToggle writes the pending value computed by requestHidden (for ToggleHidden or RequestHidden) to the registry
+// once the coalescing window has elapsed. If the registry already holds that value (e.g., an even number of toggles),
+// nothing is written. If the write fails, the state and systray are reset to the value actually stored in the
+// registry; otherwise, File Explorer windows are refreshed (see writeToggle) and the toggle is recorded in the history
+// for UndoToggle, confirmed as selected with --toggle-feedback, and announced to the --on-toggle command. Every write
+// is recorded in the audit log, attributed to the source of the last coalesced toggle.
+//
+// Parameters:
+//
+//	seq - The toggleSeq of the timer that called it; nothing is written if the toggle was superseded or cancelled.
+func (l *Library) commitToggle(seq uint64) {
+	l.toggleMu.Lock()
+	if seq != l.toggleSeq {
+		l.toggleMu.Unlock()
+		return
+	}
+	value, source := l.toggleValue, l.toggleSource
+	l.toggleTimer = nil
+	l.toggleMu.Unlock()
+
+	current, err := l.GetValue("Hidden")
+	if err != nil {
+		l.App.Logger.Errorf("%v", err)
+		return
+	}
+	if current == value {
+		l.App.Logger.Debugf("Toggles cancelled out; registry left unchanged")
+		state.Set("status_hidden", current)
+		l.RefreshSystray()
+		return
+	}
+
+	entry := auditEntry{Time: time.Now(), Old: current, New: value, Source: source, Success: true}
+	if err := l.writeToggle(value); err != nil {
+		l.App.Logger.Errorf("Could not set registry key value: %v", err)
+		entry.Success, entry.Error = false, err.Error()
+		l.App.audit(entry)
+		state.Set("status_hidden", current)
+		l.RefreshSystray()
+		return
+	}
+	l.App.audit(entry)
+	l.history.record(toggleChange{old: current, new: value})
+	l.RefreshSystray()
+	l.toggleFeedback()
+	l.runOnToggle(value)
+}
+
+// toggleFeedback confirms a successful toggle as selected with --toggle-feedback: "sound" plays the default
+// system sound, and "flash" flashes the taskbar button of the foreground window if it is File Explorer.
+func (l *Library) toggleFeedback() {
+	switch l.App.Config.ToggleFeedback {
+	case feedbackSound:
+		if err := messageBeep(); err != nil {
+			l.App.Logger.Warnf("Could not play toggle feedback sound: %v", err)
+		}
+	case feedbackFlash:
+		if hwnd := foregroundWindow(); l.IsFileExplorer(hwnd) {
+			flashWindow(hwnd, 3)
+		} else {
+			l.App.Logger.Debugf("Foreground window is not File Explorer; nothing to flash")
+		}
+	}
+}
+
+// ToggleSeparateProcess toggles the "SeparateProcess" registry value, which makes File Explorer launch folder
+// windows in a separate process, stores the new value as "status_separateProcess" in the state, and refreshes the
+// systray. A missing value is treated as disabled. No windows are refreshed, since the setting only affects
+// windows opened afterwards (and may require restarting Explorer to take effect).
+// Returns an error if the value cannot be read or written.
+func (l *Library) ToggleSeparateProcess() error {
+	value, err := l.GetValue("SeparateProcess")
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return err
+	}
+
+	var separate uint32
+	if value == 0 {
+		separate = 1
+	}
+	if err = l.SetValue("SeparateProcess", separate); err != nil {
+		return err
+	}
+
+	l.App.Logger.Infof("Set 'SeparateProcess' to %d", separate)
+	state.Set("status_separateProcess", uint64(separate))
+	l.RefreshSystray()
+
+	return nil
+}
+
+// WaitForExplorer returns a channel that receives the handle of the next File Explorer window brought to the
+// foreground, after which the channel is closed. The channel is closed without a value if ctx is cancelled or the
+// application is stopping first, or if the WinEvent hook cannot be set, in which case the error is sent to the
+// application's error channel.
+//
+// The hook is set on a dedicated OS thread that runs a message loop until a window is found or ctx is cancelled,
+// and is always removed before the channel is closed, so cancelling ctx cleanly tears down the hook.
+//
+// Parameters:
+//
+//	ctx - Cancels the wait.
+func (l *Library) WaitForExplorer(ctx context.Context) <-chan winapi.HWND {
+	out := make(chan winapi.HWND, 1)
+
+	errCh := l.App.ErrCh
+	goTracked(&l.App.wg, l.App.Logger, "File Explorer wait", 0, func() {
+		defer close(out)
+
+		// the hook's events are delivered to the message loop of the thread that set it
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		l.App.Logger.Debugf("Setting WinEvent hook")
+		hook, err := winapi.SetWinEventHook(
+			winapi.EVENT_SYSTEM_FOREGROUND,
+			winapi.EVENT_SYSTEM_FOREGROUND,
+			0,
+			l.winEventCallback(),
+			0,
+			0,
+			winapi.WINEVENT_OUTOFCONTEXT,
+		)
+		if err != nil {
+			errCh <- fmt.Errorf("failed call to SetWinEventHook: %v", err)
+			return
+		}
+
+		found := make(chan winapi.HWND, 1)
+		l.mu.Lock()
+		if l.waiters == nil {
+			l.waiters = map[windows.Handle]chan<- winapi.HWND{}
+		}
+		l.waiters[hook] = found
+		l.mu.Unlock()
+
+		defer func() {
+			l.mu.Lock()
+			delete(l.waiters, hook)
+			l.mu.Unlock()
+			_ = winapi.UnhookWinEvent(hook)
+		}()
+
+		threadId := windows.GetCurrentThreadId()
+		result := make(chan winapi.HWND, 1)
+		done := make(chan struct{})
+		goSafe(l.App.Logger, "File Explorer wait helper", 0, func() {
+			var hwnd winapi.HWND
+			select {
+			case hwnd = <-found:
+			case <-ctx.Done():
+			case <-l.App.done:
+			case <-done:
+				result <- 0
+				return
+			}
+			result <- hwnd
+			if err := winapi.PostThreadMessage(threadId, winapi.WM_QUIT, 0, 0); err != nil {
+				l.App.Logger.Warnf("Could not post WM_QUIT to thread %d: %v", threadId, err)
+			}
+		})
+
+		l.App.Logger.Debugf("Waiting for File Explorer")
+		var msg winapi.MSG
+		for {
+			// GetMessage returns a nonzero value for a message, 0 for WM_QUIT, and -1 on error (e.g., an invalid
+			// window handle); only in the latter case is the error meaningful, since it carries the last error
+			// code even on success. The error does not go away by calling it again, so stop instead of spinning.
+			r1, err := winapi.GetMessage(msg, 0, 0, 0)
+			if r1 == 0 {
+				l.App.Logger.Debugf("Received WM_QUIT")
+				break
+			}
+			if int32(r1) == -1 {
+				errCh <- fmt.Errorf("failed call to GetMessage: %v", err)
+				break
+			}
+			_ = winapi.TranslateMessage(msg)
+			winapi.DispatchMessage(msg)
+		}
+		close(done)
+
+		if hwnd := <-result; hwnd != 0 {
+			out <- hwnd
+		}
+	})
+
+	return out
+}
+
+// WatchMessageLoop waits in the background (see WaitForExplorer) for the next File Explorer window to be brought
+// to the foreground and refreshes it after a short delay, unless it shows a folder listed with --no-refresh-folder
+// (see skipsRefresh).
+// Only one wait is pending at a time; calling WatchMessageLoop while one is pending does nothing.
+func (l *Library) WatchMessageLoop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.waitCancel != nil {
+		l.App.Logger.Debugf("Already waiting for File Explorer")
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.waitCancel = cancel
+
+	found := l.WaitForExplorer(ctx)
+	goSafe(l.App.Logger, "File Explorer refresh", 0, func() {
+		hwnd, ok := <-found
+
+		l.mu.Lock()
+		l.waitCancel = nil
+		l.mu.Unlock()
+		cancel()
+
+		if !ok {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+		if !l.skipsRefresh(hwnd) {
+			l.PostRefreshMessage(hwnd)
+		}
+	})
+}
+
+// WatchReconcile starts a goroutine that re-reads the "Hidden" registry value on every tick of the given interval.
+// It acts as a safety net for the event-driven watchers: if the value has drifted from the application state
+// (e.g., a change notification was missed), the state is updated and the systray and Explorer windows are refreshed.
+// Errors encountered while reading the value are sent to the application's error channel and the loop continues.
+// Like watchRegistryPoll, it stops once the application is stopping, and onExit waits for it, so that it neither
+// blocks on the error channel nor takes the state cleared on exit for a drift.
+func (l *Library) WatchReconcile(interval time.Duration) {
+	errCh := l.App.ErrCh
+	goTracked(&l.App.wg, l.App.Logger, "reconciliation loop", watcherRestarts, func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		l.App.Logger.Debugf("Reconciling %q every %s", l.App.Config.KeyPath, interval)
+		for {
+			select {
+			case <-ticker.C:
+			case <-l.App.done:
+				l.App.Logger.Debugf("Stopping reconciliation loop")
+				return
+			}
+
+			_, value, err := l.GetKeyValuePair(true)
+			if err != nil {
+				select {
+				case errCh <- fmt.Errorf("failed to reconcile: %v", err):
+				case <-l.App.done:
+					return
+				}
+				continue
+			}
+			if hidden, ok := state.Get[uint64]("status_hidden"); !ok || hidden == value {
+				continue
+			}
+
+			l.App.Logger.Infof("Reconciled drifted value of 'Hidden' to %d", value)
+			l.applyHidden(value)
+		}
+	})
+}
+
+// WatchRegistryKey starts a goroutine that monitors changes to a specific Windows registry key.
+// With --watch-mode=poll it delegates to watchRegistryPoll; otherwise it opens the registry key,
+// sets up a notification event, and waits for changes to the key's value.
+// Once the first change notification is armed, it sets "watcher_ready" in the state and refreshes the systray.
+// When a change is detected, it retrieves the updated value and applies it (see applyHidden).
+// The goroutine stops once the application is stopping (see Application.stop), or if waiting for the event fails or
+// returns anything other than a change notification; onExit waits for it to release the key and events.
+// Errors encountered during monitoring are sent to the application's error channel and recorded for WatcherError.
+// "watcher_running" is set in the state while the goroutine runs (see WatcherRunning).
+func (l *Library) WatchRegistryKey() {
+	if l.App.Config.WatchMode == watchPoll {
+		l.watchRegistryPoll(l.App.Config.PollInterval)
+		return
+	}
+
+	errCh := l.App.ErrCh
+	goTracked(&l.App.wg, l.App.Logger, "registry watcher", watcherRestarts, func() {
+		l.setWatcherRunning(true)
+		defer l.setWatcherRunning(false)
+
+		root, path := l.userKey(l.App.Config.KeyPath)
+		l.App.Logger.Debugf("Retrieving handle for key %q", path)
+		var hKey windows.Handle
+		if err := windows.RegOpenKeyEx(windows.Handle(root), windows.StringToUTF16Ptr(path), 0, windows.KEY_NOTIFY, &hKey); err != nil {
+			l.watcherFailed(errCh, fmt.Errorf("failed call to RegOpenKeyEx: %v", err))
+			return
+		}
+		defer func() { _ = windows.RegCloseKey(hKey) }()
+
+		l.App.Logger.Debugf("Creating RegNotify event")
+		event, err := windows.CreateEvent(nil, 0, 0, nil)
+		if err != nil {
+			l.watcherFailed(errCh, fmt.Errorf("failed call to CreateEvent: %v", err))
+			return
+		}
+		defer func() { _ = windows.CloseHandle(event) }()
+
+		stop, release, err := l.stopEvent()
+		if err != nil {
+			l.watcherFailed(errCh, err)
+			return
+		}
+		defer release()
+
+		l.App.Logger.Debugf("Watching %q", l.App.Config.KeyPath)
+		for {
+			err = windows.RegNotifyChangeKeyValue(hKey, true, windows.REG_NOTIFY_CHANGE_LAST_SET, event, true)
+			if err != nil {
+				l.watcherFailed(errCh, fmt.Errorf("failed call to RegNotifyChangeKeyValue: %v", err))
+				return
+			}
+			l.setWatcherReady()
+
+			r1, err := windows.WaitForMultipleObjects([]windows.Handle{event, stop}, false, windows.INFINITE)
+			switch r1 {
+			case windows.WAIT_OBJECT_0 + 1:
+				l.App.Logger.Debugf("Stopping registry watcher")
+				return
+			case windows.WAIT_OBJECT_0:
+				_, value, err := l.GetKeyValuePair(true)
+				if err != nil {
+					l.watcherFailed(errCh, fmt.Errorf("failed call to GetKeyValuePair: %v", err))
+					return
+				}
+				l.applyHidden(value)
+			case windows.WAIT_FAILED:
+				l.watcherFailed(errCh, fmt.Errorf("failed call to WaitForMultipleObjects: %v", err))
+				return
+			default:
+				// WAIT_ABANDONED only applies to mutexes and WAIT_TIMEOUT cannot occur with INFINITE, so either means
+				// the events can no longer be relied on; re-arming them would busy-loop.
+				l.watcherFailed(errCh, fmt.Errorf("unexpected result of WaitForMultipleObjects: %#x", r1))
+				return
+			}
+		}
+	})
+}
+
+// watchRegistryPoll starts a goroutine that re-reads the "Hidden" registry value on every tick of the given interval,
+// as a fallback for environments where registry change notifications are unreliable (e.g., roaming profiles).
+// It sets "watcher_ready" once the value has been read, and applies the value (see applyHidden) whenever it differs
+// from the previous read. Errors encountered while reading the value are sent to the application's error channel
+// (and recorded for WatcherError) and polling continues. Like WatchRegistryKey, it sets "watcher_running" and stops
+// once the application is stopping.
+//
+// Parameters:
+//
+//	interval - How often the value is re-read.
+func (l *Library) watchRegistryPoll(interval time.Duration) {
+	errCh := l.App.ErrCh
+	goTracked(&l.App.wg, l.App.Logger, "registry poller", watcherRestarts, func() {
+		l.setWatcherRunning(true)
+		defer l.setWatcherRunning(false)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		l.App.Logger.Debugf("Polling %q every %s", l.App.Config.KeyPath, interval)
+		var last uint64
+		for {
+			if _, value, err := l.GetKeyValuePair(true); err != nil {
+				l.watcherFailed(errCh, fmt.Errorf("failed to poll: %v", err))
+			} else {
+				if ready, _ := state.Get[bool]("watcher_ready"); ready && value != last {
+					l.applyHidden(value)
+				}
+				last = value
+				l.setWatcherReady()
+			}
+
+			select {
+			case <-ticker.C:
+			case <-l.App.done:
+				l.App.Logger.Debugf("Stopping registry poller")
+				return
+			}
+		}
+	})
+}
+
+// WatcherRunning reports whether the goroutine started by WatchRegistryKey is running. It is false before the
+// watcher is started and after it stopped because of an error (see WatcherError) or a panic it was not restarted from.
+func (l *Library) WatcherRunning() bool {
+	running, _ := state.Get[bool]("watcher_running")
+	return running
+}
+
+// WatcherError returns the message of the last error encountered by the registry watcher, or "" if there was none.
+// Errors of --watch-mode=poll are usually transient, so the watcher may still be running after one.
+func (l *Library) WatcherError() string {
+	msg, _ := state.Get[string]("watcher_error")
+	return msg
+}
+
+// setWatcherRunning sets "watcher_running" in the state and refreshes the systray, which shows a stopped watcher.
+// While the application is stopping, the watcher is expected to stop, so neither is a warning logged nor is the
+// systray refreshed.
+//
+// Parameters:
+//
+//	running - Whether the registry watcher is running.
+func (l *Library) setWatcherRunning(running bool) {
+	state.Set("watcher_running", running)
+	if l.App.stopping() {
+		return
+	}
+	if !running {
+		l.App.Logger.Warnf("Registry watcher stopped")
+	}
+	l.RefreshSystray()
+}
+
+// stopEvent returns a manual-reset event that is set once the application is stopping (see Application.stop), for
+// goroutines blocked in a wait on Windows objects, along with a function that releases the event, which the caller
+// must call once done waiting.
+func (l *Library) stopEvent() (windows.Handle, func(), error) {
+	stop, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed call to CreateEvent: %v", err)
+	}
+
+	released := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-l.App.done:
+			_ = windows.SetEvent(stop)
+		case <-released:
+		}
+	}()
+
+	return stop, func() {
+		close(released)
+		<-exited
+		_ = windows.CloseHandle(stop)
+	}, nil
+}
+
+// watcherFailed records err as the last error of the registry watcher (see WatcherError) and sends it to errCh.
+//
+// Parameters:
+//
+//	errCh - The application's error channel.
+//	err   - The error encountered by the watcher.
+func (l *Library) watcherFailed(errCh chan error, err error) {
+	state.Set("watcher_error", err.Error())
+	errCh <- err
+}
+
+// setWatcherReady sets "watcher_ready" in the state and refreshes the systray the first time it is called.
+func (l *Library) setWatcherReady() {
+	if ready, _ := state.Get[bool]("watcher_ready"); !ready {
+		l.App.Logger.Debugf("Registry watcher ready")
+		state.Set("watcher_ready", true)
+		l.RefreshSystray()
+	}
+}
+
+// writeToggle writes value to "Hidden" for a toggle (or its undo or redo) through SetHidden, and remembers it as
+// "toggle_written" for policyRevertWindow (see checkPolicyOverride).
+// While the registry watcher runs, File Explorer windows are refreshed right away rather than by the watcher, and
+// the value is remembered as "own_write" beforehand so that the watcher ignores the change notification of this
+// write instead of refreshing them a second time (see ownWrite). Without the watcher, SetHidden refreshes them.
+//
+// Parameters:
+//
+//	value - The hidden files status to write.
+func (l *Library) writeToggle(value uint64) error {
+	own := l.WatcherRunning()
+	if own {
+		state.SetTTL("own_write", value, l.App.Config.notifyWindow(), nil)
+	}
+
+	if err := l.SetHidden(value); err != nil {
+		if own {
+			state.Delete("own_write")
+		}
+		return err
+	}
+	state.SetTTL("toggle_written", value, policyRevertWindow, nil)
+
+	if own && !l.App.Config.NoRefresh && !refreshSuspended() {
+		settle(l.App.Logger, l.App.Config.SettleDelay)
+		l.refreshChanged()
+	}
+
+	return nil
+}
+
+// ownWrite reports whether value was written by a toggle within ownWriteWindow (see writeToggle), in which case
+// the change was already handled. The "own_write" mark is consumed by whichever change is seen first, so a genuine
+// external change arriving in the same window is applied, and cannot cause a later one to be ignored.
+//
+// Parameters:
+//
+//	value - The new value of "Hidden" seen by the registry watcher.
+func (l *Library) ownWrite(value uint64) bool {
+	written, ok := state.Get[uint64]("own_write")
+	if !ok {
+		return false
+	}
+	state.Delete("own_write")
+
+	return written == value
+}
+
+// viewTooltipLines lists the view-related values besides "Hidden" that are shown in the tray tooltip (see
+// viewTooltip): the state entry holding each (see storeViewSettings), its label, and the value meaning shown.
+var viewTooltipLines = []struct {
+	key   string
+	label string
+	shown uint64
+}{
+	{"status_hideFileExt", "File extensions", 0},
+	{"status_showSuperHidden", "Protected files", 1},
+}
+
+// viewTooltip returns the lines appended to the tray tooltip, one for each entry of viewTooltipLines that is stored
+// in the state, stating whether it is shown or hidden (e.g., "\nFile extensions: shown").
+func viewTooltip() string {
+	var b strings.Builder
+	for _, line := range viewTooltipLines {
+		value, ok := state.Get[uint64](line.key)
+		if !ok {
+			continue
+		}
+		status := "hidden"
+		if value == line.shown {
+			status = "shown"
+		}
+		b.WriteString("\n" + line.label + ": " + status)
+	}
+
+	return b.String()
+}
+
+// storeViewSettings reads the view-related values (see ViewSettings) and stores those listed in viewTooltipLines in
+// the state for the tray tooltip. If they cannot be read, the stored values are left as they are.
+func (l *Library) storeViewSettings() {
+	settings, err := l.ViewSettings()
+	if err != nil {
+		l.App.Logger.Debugf("Could not read view settings: %v", err)
+		return
+	}
+	state.Set("status_hideFileExt", settings.HideFileExt)
+	state.Set("status_showSuperHidden", settings.ShowSuperHidden)
+}
+
+// applyHidden is called by the registry watchers (and WatchReconcile) when the "Hidden" value changed.
+// It checks whether a policy reverted a recent toggle (see checkPolicyOverride), stores the value in the state,
+// and refreshes the systray and, once the value settled (see settle), File Explorer windows (see refreshChanged).
+// With --no-refresh, or while refreshing is suspended (see refreshSuspended), only the systray is refreshed. Values
+// written by a toggle are ignored (see ownWrite). Since the watcher also wakes up when another value of the key
+// changes, the values shown in the tray tooltip besides "Hidden" are re-read first (see storeViewSettings), and the
+// systray is refreshed if any of them changed.
+//
+// Parameters:
+//
+//	value - The new value of "Hidden".
+func (l *Library) applyHidden(value uint64) {
+	if !l.App.Config.NoTray {
+		before := viewTooltip()
+		l.storeViewSettings()
+		if viewTooltip() != before {
+			l.RefreshSystray()
+		}
+	}
+	if l.ownWrite(value) {
+		l.App.Logger.Debugf("Ignoring own change of 'Hidden' to %d", value)
+		return
+	}
+	l.checkPolicyOverride(value)
+	state.Set("status_hidden", value)
+	l.RefreshSystray()
+	if l.App.Config.NoRefresh {
+		l.App.Logger.Debugf("Not refreshing File Explorer windows (--no-refresh)")
+		return
+	}
+	if refreshSuspended() {
+		l.App.Logger.Debugf("Not refreshing File Explorer windows; refreshing is suspended for a batch")
+		return
+	}
+	settle(l.App.Logger, l.App.Config.SettleDelay)
+	l.refreshChanged()
+}
+
+// winEventCallback returns the callback for winEventProc, creating it on first use.
+// Like enumWindowsCallback, a single callback is reused for every WinEvent hook.
+func (l *Library) winEventCallback() uintptr {
+	l.eventOnce.Do(func() {
+		l.eventCallback = windows.NewCallback(l.winEventProc)
+	})
+
+	return l.eventCallback
+}
+
+// childWindowsCallback returns the callback for childWindowsProc, creating it on first use.
+// Like enumWindowsCallback, a single callback is reused for every enumeration.
+func (l *Library) childWindowsCallback() uintptr {
+	l.childOnce.Do(func() {
+		l.childCallback = windows.NewCallback(childWindowsProc)
+	})
+
+	return l.childCallback
+}
+
+// childWindowsProc is the callback for EnumChildWindows that collects the child windows of a window into the slice
+// registered in callbackParams with the ID lParam. It returns 1 to continue enumeration, or 0 if there is no such
+// slice.
+func childWindowsProc(hwnd winapi.HWND, lParam uintptr) uintptr {
+	children, ok := callbackParams.get(lParam).(*[]winapi.HWND)
+	if !ok {
+		return 0
+	}
+	*children = append(*children, hwnd)
+	return 1
+}
+
+// enumWindowsCallback returns the callback for enumWindowsProc, creating it on first use.
+// Callbacks created by windows.NewCallback are never released, so a single one is reused for every enumeration.
+func (l *Library) enumWindowsCallback() uintptr {
+	l.enumOnce.Do(func() {
+		l.enumCallback = windows.NewCallback(l.enumWindowsProc)
+	})
+
+	return l.enumCallback
+}
+
+// enumWindowsProc is the callback for EnumWindows, which passes each window to visitWindow.
+// The function returns 1 to continue enumeration, or 0 to stop it once the enumeration's context is cancelled.
+//
+// Parameters:
+//
+//	hwnd   - The handle to the window being enumerated.
+//	lParam - The ID of the enumState of the enumeration in callbackParams.
+//
+// Returns:
+//
+//	uintptr - 1 to continue enumeration, 0 to stop it.
+func (l *Library) enumWindowsProc(hwnd winapi.HWND, lParam uintptr) uintptr {
+	defer recoverCallback(l.App.Logger, "enumWindowsProc")
+
+	if enum, ok := callbackParams.get(lParam).(*enumState); ok && l.visitWindow(enum, hwnd) {
+		return 1
+	}
+	return 0
+}
+
+// visitWindow handles a window enumerated by enumWindows. It checks if the window corresponds to a File Explorer
+// window, in which case it increments the found count and posts a refresh message to the window.
+// Windows showing a folder listed with --no-refresh-folder are counted but only their other tabs are refreshed (see
+// skipsRefresh), and windows of third-party
+// file managers listed with --refresh-class are refreshed with an F5 key press but not counted.
+// When the enumeration only inspects windows (see ExplorerWindows), every window is passed to its visit
+// function instead and nothing is refreshed. Reports whether to continue, i.e., whether enum.ctx is not cancelled.
+//
+// Parameters:
+//
+//	enum - The state of the enumeration.
+//	hwnd - The window handle of the current window being enumerated.
+func (l *Library) visitWindow(enum *enumState, hwnd winapi.HWND) bool {
+	if enum.ctx.Err() != nil {
+		return false
+	}
+	if enum.visit != nil {
+		explorer := l.IsFileExplorer(hwnd)
+		if explorer {
+			enum.found++
+		}
+		enum.visit(hwnd, explorer)
+		return true
+	}
+	if l.IsFileExplorer(hwnd) {
+		enum.found++
+		if !enum.handled[hwnd] && !l.skipsRefresh(hwnd) {
+			l.PostRefreshMessage(hwnd)
+		}
+	} else if l.isRefreshClass(hwnd) {
+		l.postRefreshKey(hwnd)
+	}
+	return true
+}
+
+// skipsRefresh reports whether the specified File Explorer window must not be refreshed as a whole because it shows
+// a folder listed with --no-refresh-folder (or one below it), so that the view of that folder is not reset. On
+// Windows 11, its other tabs are then refreshed one by one instead (see refreshTabs). A window whose folders cannot be
+// read is refreshed.
+//
+// Parameters:
+//
+//	hwnd - The window handle of the File Explorer window.
+func (l *Library) skipsRefresh(hwnd winapi.HWND) bool {
+	if len(l.App.Config.NoRefreshFolders) == 0 {
+		return false
+	}
+
+	skipped, err := l.refreshTabs(hwnd)
+	if err != nil {
+		l.warns.Warnf(l.App.Logger, "Could not read the folders of window handle %d: %v", hwnd, err)
+		return false
+	}
+
+	return skipped
+}
+
+// noRefreshFolder reports whether path is, or is below, one of the folders listed with --no-refresh-folder (see
+// folderRule).
+//
+// Parameters:
+//
+//	path - The folder shown by a File Explorer window, or "" if it shows something else.
+func (l *Library) noRefreshFolder(path string) bool {
+	return folderRule(l.App.Config.NoRefreshFolders, path) != ""
+}
+
+// winEventProc is a Windows event hook procedure for handling accessibility events.
+// It checks if the event is associated with a File Explorer window and, if so, passes the window
+// handle on to the WaitForExplorer call that set the hook. The function ignores events for non-root
+// objects (objId != 0) and always returns 0 as required by the Windows event hook signature.
+//
+// Parameters:
+//
+//	eventHook     - Handle to the event hook.
+//	event         - Event type identifier.
+//	hwnd          - Handle to the window receiving the event.
+//	objectId      - Object identifier for the event.
+//	childId       - Child identifier for the event.
+//	eventThreadId - Thread ID where the event occurred.
+//	eventTime     - Timestamp of the event.
+//
+// Returns:
+//
+//	uintptr - Always returns 0.
+func (l *Library) winEventProc(eventHook windows.Handle, event uint32, hwnd winapi.HWND, objectId, childId int32,
+	eventThreadId, eventTime uint32,
+) uintptr {
+	defer recoverCallback(l.App.Logger, "winEventProc")
+
+	if objectId != 0 || !l.IsFileExplorer(hwnd) {
+		return 0
+	}
+
+	l.mu.Lock()
+	found, ok := l.waiters[eventHook]
+	l.mu.Unlock()
+	if ok {
+		select {
+		case found <- hwnd:
+		default:
+		}
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows && integration
+
+package app
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"golang.org/x/sys/windows/registry"
+)
+
+// Integration tests run against the real registry, in a throwaway key instead of regKeyPath:
+//
+//	go test -tags integration ./app
+
+const (
+	testParentKeyPath = `Software\ShowAllFiles`
+	testKeyPath       = testParentKeyPath + `\Test`
+)
+
+// newRegistryTestLibrary creates testKeyPath holding the given "Hidden" value and returns a Library that reads
+// and writes it. The key (and its parent, if the test created it) is deleted when the test finishes.
+func newRegistryTestLibrary(t *testing.T, hidden uint32) *Library {
+	t.Helper()
+
+	parent, parentExisted, err := registry.CreateKey(registry.CURRENT_USER, testParentKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		t.Fatalf("CreateKey(%q) = %v", testParentKeyPath, err)
+	}
+	_ = parent.Close()
+
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, testKeyPath, registry.SET_VALUE)
+	if err != nil {
+		t.Fatalf("CreateKey(%q) = %v", testKeyPath, err)
+	}
+	t.Cleanup(func() {
+		if err := registry.DeleteKey(registry.CURRENT_USER, testKeyPath); err != nil {
+			t.Errorf("DeleteKey(%q) = %v", testKeyPath, err)
+		}
+		if !parentExisted {
+			_ = registry.DeleteKey(registry.CURRENT_USER, testParentKeyPath)
+		}
+	})
+	defer func() { _ = key.Close() }()
+
+	if err = key.SetDWordValue("Hidden", hidden); err != nil {
+		t.Fatalf("SetDWordValue() = %v", err)
+	}
+
+	return newTestLibraryAt(testKeyPath)
+}
+
+// readTestHidden returns the "Hidden" value of testKeyPath.
+func readTestHidden(t *testing.T) uint64 {
+	t.Helper()
+
+	key, err := registry.OpenKey(registry.CURRENT_USER, testKeyPath, registry.QUERY_VALUE)
+	if err != nil {
+		t.Fatalf("OpenKey(%q) = %v", testKeyPath, err)
+	}
+	defer func() { _ = key.Close() }()
+
+	value, _, err := key.GetIntegerValue("Hidden")
+	if err != nil {
+		t.Fatalf("GetIntegerValue() = %v", err)
+	}
+	return value
+}
+
+func TestIntegrationGetKeyValuePair(t *testing.T) {
+	l := newRegistryTestLibrary(t, uint32(statusHidden))
+
+	_, value, err := l.GetKeyValuePair(true)
+	if err != nil {
+		t.Fatalf("GetKeyValuePair() = %v", err)
+	}
+	if value != statusHidden {
+		t.Errorf("GetKeyValuePair() value = %d, want %d", value, statusHidden)
+	}
+
+	if _, err = l.GetValue("Missing"); !errors.Is(err, registry.ErrNotExist) {
+		t.Errorf("GetValue(\"Missing\") = %v, want %v", err, registry.ErrNotExist)
+	}
+}
+
+func TestIntegrationToggleHidden(t *testing.T) {
+	tests := []struct {
+		name string
+		from uint64
+		want uint64
+	}{
+		{"hidden to visible", statusHidden, statusVisible},
+		{"visible to hidden", statusVisible, statusHidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			l := newRegistryTestLibrary(t, uint32(tt.from))
+
+			l.ToggleHidden(sourceMenu)
+
+			waitFor(t, "toggle_written")
+			if got := readTestHidden(t); got != tt.want {
+				t.Errorf("registry value after ToggleHidden() = %d, want %d", got, tt.want)
+			}
+			if got, _ := state.Get[uint64]("status_hidden"); got != tt.want {
+				t.Errorf("state[status_hidden] = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,822 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/kamaranl/winapi"
+	"github.com/sirupsen/logrus"
+	"golang.design/x/hotkey"
+	"golang.org/x/sys/windows/registry"
+)
+
+// fakeKey is a RegistryKey holding the "Hidden" value, as a DWORD or, if str is set, as a string, and, optionally,
+// other values. Every written value of "Hidden" is sent to sets.
+type fakeKey struct {
+	mu     sync.Mutex
+	hidden uint64
+	str    string
+	others map[string]uint64
+	getErr error
+	sets   chan uint32
+}
+
+func (k *fakeKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.getErr != nil {
+		return 0, 0, k.getErr
+	}
+	if name != "Hidden" {
+		value, ok := k.others[name]
+		if !ok {
+			return 0, 0, registry.ErrNotExist
+		}
+		return value, registry.DWORD, nil
+	}
+	if k.str != "" {
+		return 0, registry.SZ, registry.ErrUnexpectedType
+	}
+	return k.hidden, registry.DWORD, nil
+}
+
+func (k *fakeKey) GetStringValue(name string) (string, uint32, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if name != "Hidden" || k.str == "" {
+		return "", registry.DWORD, registry.ErrUnexpectedType
+	}
+	return k.str, registry.SZ, nil
+}
+
+func (k *fakeKey) SetDWordValue(name string, value uint32) error {
+	k.mu.Lock()
+	if name == "Hidden" {
+		k.hidden, k.str = uint64(value), ""
+	}
+	k.mu.Unlock()
+
+	k.sets <- value
+	return nil
+}
+
+func (k *fakeKey) Close() error { return nil }
+
+// newTestLibrary returns a Library that reads and writes key (see newTestLibraryAt).
+func newTestLibrary(key *fakeKey) *Library {
+	l := newTestLibraryAt(regKeyPath)
+	l.OpenKey = func(uint32) (RegistryKey, error) { return key, nil }
+
+	return l
+}
+
+// newTestLibraryAt returns a Library for the registry key at keyPath that runs without a tray, does not wait before
+// refreshing, and discards its log.
+func newTestLibraryAt(keyPath string) *Library {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	config := DefaultConfig()
+	config.KeyPath, config.NoTray, config.SettleDelay = keyPath, true, 0
+
+	return NewLibrary("ShowAllFiles", config, logger)
+}
+
+// waitFor waits up to a second for key to be set in the state (e.g., "toggle_written" once commitToggle wrote a
+// toggle), failing the test otherwise.
+func waitFor(t *testing.T, key string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if slices.Contains(state.Keys(), key) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state[%s] not set", key)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestToggleHidden(t *testing.T) {
+	tests := []struct {
+		name string
+		from uint64
+		want uint64
+	}{
+		{"hidden to visible", statusHidden, statusVisible},
+		{"visible to hidden", statusVisible, statusHidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			key := &fakeKey{hidden: tt.from, sets: make(chan uint32, 1)}
+			l := newTestLibrary(key)
+
+			l.ToggleHidden(sourceMenu)
+			if got, _ := state.Get[uint64]("status_hidden"); got != tt.want {
+				t.Errorf("state[status_hidden] = %d, want %d", got, tt.want)
+			}
+
+			select {
+			case got := <-key.sets:
+				if uint64(got) != tt.want {
+					t.Errorf("SetDWordValue(\"Hidden\", %d), want %d", got, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("SetDWordValue() not called")
+			}
+
+			// Wait for commitToggle to finish so that it does not write to the state of the next test.
+			waitFor(t, "toggle_written")
+			if got, _ := state.Get[uint64]("status_hidden"); got != tt.want {
+				t.Errorf("state[status_hidden] after commit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetKeyValuePair(t *testing.T) {
+	l := newTestLibrary(&fakeKey{hidden: statusVisible})
+	_, value, err := l.GetKeyValuePair(true)
+	if err != nil {
+		t.Fatalf("GetKeyValuePair() = %v", err)
+	}
+	if value != statusVisible {
+		t.Errorf("GetKeyValuePair() value = %d, want %d", value, statusVisible)
+	}
+
+	l = newTestLibrary(&fakeKey{getErr: errors.New("access denied")})
+	if _, _, err := l.GetKeyValuePair(true); err == nil {
+		t.Error("GetKeyValuePair() error = nil, want an error")
+	}
+}
+
+func TestHiddenString(t *testing.T) {
+	key := &fakeKey{str: "1", sets: make(chan uint32, 1)}
+	l := newTestLibrary(key)
+	l.App.Config.ReadOnly = true
+
+	if value, err := l.GetValue("Hidden"); err != nil || value != statusVisible {
+		t.Errorf("GetValue(\"Hidden\") = %d, %v, want %d", value, err, statusVisible)
+	}
+	if settings, err := l.ViewSettings(); err != nil || settings.Hidden != statusVisible {
+		t.Errorf("ViewSettings().Hidden = %d, %v, want %d", settings.Hidden, err, statusVisible)
+	}
+	if _, value, err := l.GetKeyValuePair(true); err != nil || value != statusVisible {
+		t.Errorf("GetKeyValuePair() = %d, %v, want %d", value, err, statusVisible)
+	}
+	if len(key.sets) != 0 {
+		t.Error("string value normalized with --read-only")
+	}
+
+	l.App.Config.ReadOnly = false
+	if _, _, err := l.GetKeyValuePair(true); err != nil {
+		t.Fatalf("GetKeyValuePair() = %v", err)
+	}
+	if key.str != "" || key.hidden != statusVisible {
+		t.Errorf("Hidden = %q/%d after GetKeyValuePair(), want a DWORD of %d", key.str, key.hidden, statusVisible)
+	}
+
+	key.str = "3"
+	if _, err := l.GetValue("Hidden"); err == nil {
+		t.Error("GetValue(\"Hidden\") error = nil for an invalid string, want an error")
+	}
+}
+
+func TestToggleHiddenReadError(t *testing.T) {
+	state.Clear()
+	key := &fakeKey{getErr: errors.New("access denied"), sets: make(chan uint32, 1)}
+	l := newTestLibrary(key)
+
+	l.ToggleHidden(sourceMenu)
+	if _, ok := state.Get[uint64]("status_hidden"); ok {
+		t.Error("state[status_hidden] set despite read error")
+	}
+
+	select {
+	case got := <-key.sets:
+		t.Errorf("SetDWordValue(\"Hidden\", %d) called despite read error", got)
+	case <-time.After(2 * defaultWatchDebounce):
+	}
+}
+
+func TestOwnWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		running bool
+		seen    []uint64
+		want    []bool
+	}{
+		{"own change ignored once", true, []uint64{statusVisible, statusVisible}, []bool{true, false}},
+		{"external change applied", true, []uint64{statusHidden, statusVisible}, []bool{false, false}},
+		{"watcher not running", false, []uint64{statusVisible}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			key := &fakeKey{hidden: statusHidden, sets: make(chan uint32, 1)}
+			l := newTestLibrary(key)
+			l.App.Config.NoRefresh = true
+			state.Set("watcher_running", tt.running)
+
+			if err := l.writeToggle(statusVisible); err != nil {
+				t.Fatalf("writeToggle() error = %v", err)
+			}
+			for i, value := range tt.seen {
+				if got := l.ownWrite(value); got != tt.want[i] {
+					t.Errorf("ownWrite(%d) #%d = %v, want %v", value, i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSetHiddenForSIDInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		sid   string
+		value uint64
+	}{
+		{"malformed SID", "not-a-sid", statusHidden},
+		{"empty SID", "", statusHidden},
+		{"invalid value", "S-1-5-21-1-2-3-1001", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLibrary(&fakeKey{})
+			if err := l.SetHiddenForSID(tt.sid, tt.value); err == nil {
+				t.Errorf("SetHiddenForSID(%q, %d) error = nil, want an error", tt.sid, tt.value)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	state.Clear()
+	key := &fakeKey{hidden: statusHidden, sets: make(chan uint32, 1)}
+	l := newTestLibrary(key)
+	l.App.Config.ReadOnly = true
+
+	if err := l.SetHidden(statusVisible); !errors.Is(err, errReadOnly) {
+		t.Errorf("SetHidden() error = %v, want %v", err, errReadOnly)
+	}
+	l.ToggleHidden(sourceMenu)
+	if _, ok := state.Get[uint64]("status_hidden"); ok {
+		t.Error("state[status_hidden] set despite --read-only")
+	}
+
+	select {
+	case got := <-key.sets:
+		t.Errorf("SetDWordValue(\"Hidden\", %d) called despite --read-only", got)
+	case <-time.After(2 * defaultWatchDebounce):
+	}
+}
+
+func TestPolicyCooldownKeepsRevert(t *testing.T) {
+	state.Clear()
+	defer state.Clear()
+	key := &fakeKey{hidden: statusVisible, sets: make(chan uint32, 1)}
+	l := newTestLibrary(key)
+	state.Set("timer_temporary", statusHidden)
+	state.Set("policy_cooldown", true)
+
+	if err := l.RequestHidden(statusHidden, sourceHTTP); !errors.Is(err, errPolicyOverride) {
+		t.Fatalf("RequestHidden() error = %v, want %v", err, errPolicyOverride)
+	}
+	if _, ok := state.Get[uint64]("timer_temporary"); !ok {
+		t.Error("refused toggle cancelled the pending revert of ShowTemporarily")
+	}
+}
+
+func TestShowTemporarilyCancelsToggle(t *testing.T) {
+	state.Clear()
+	defer state.Clear()
+	key := &fakeKey{hidden: statusVisible, sets: make(chan uint32, 1)}
+	l := newTestLibrary(key)
+	l.App.Config.WatchDebounce = 50 * time.Millisecond
+
+	if err := l.RequestHidden(statusHidden, sourceHTTP); err != nil {
+		t.Fatalf("RequestHidden() error = %v", err)
+	}
+	if _, err := l.ShowTemporarily(time.Hour); err != nil {
+		t.Fatalf("ShowTemporarily() error = %v", err)
+	}
+	time.Sleep(2 * l.App.Config.WatchDebounce)
+	select {
+	case got := <-key.sets:
+		t.Errorf("pending toggle wrote %d after ShowTemporarily", got)
+	default:
+	}
+	if got, _ := state.Get[uint64]("status_hidden"); got != statusVisible {
+		t.Errorf("status_hidden = %d, want %d", got, statusVisible)
+	}
+}
+
+func TestHandleSet(t *testing.T) {
+	state.Clear()
+	key := &fakeKey{hidden: statusHidden, sets: make(chan uint32, 1)}
+	l := newTestLibrary(key)
+	l.App.Lib = l
+
+	w := httptest.NewRecorder()
+	l.App.handleSet(statusVisible)(w, httptest.NewRequest(http.MethodPost, "/show", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("handleSet() code = %d, want %d (%s)", w.Code, http.StatusOK, w.Body)
+	}
+	waitFor(t, "toggle_written")
+	if got := <-key.sets; uint64(got) != statusVisible {
+		t.Errorf("SetDWordValue(\"Hidden\", %d), want %d", got, statusVisible)
+	}
+	if undo, _ := l.history.available(); !undo {
+		t.Error("change over HTTP not recorded in the history")
+	}
+
+	l.App.Config.ReadOnly = true
+	w = httptest.NewRecorder()
+	l.App.handleSet(statusHidden)(w, httptest.NewRequest(http.MethodPost, "/hide", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("handleSet() with --read-only code = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestWriteValueAudit(t *testing.T) {
+	key := &fakeKey{hidden: statusHidden, others: map[string]uint64{}, sets: make(chan uint32, 2)}
+	l := newTestLibrary(key)
+	l.App.Lib = l
+	var audit bytes.Buffer
+	l.App.Audit = &audit
+
+	if err := l.App.writeValue("Hidden", uint32(statusVisible)); err != nil {
+		t.Fatalf("writeValue() error = %v", err)
+	}
+	if err := l.App.writeValue("HideFileExt", 0); err != nil {
+		t.Fatalf("writeValue() error = %v", err)
+	}
+
+	var entry auditEntry
+	if err := json.Unmarshal(audit.Bytes(), &entry); err != nil {
+		t.Fatalf("audit log %q: %v", audit.String(), err)
+	}
+	if entry.Old != statusHidden || entry.New != statusVisible || entry.Source != sourceCLI || !entry.Success {
+		t.Errorf("audit entry = %+v, want a successful write from %d to %d by %q",
+			entry, statusHidden, statusVisible, sourceCLI)
+	}
+}
+
+func TestSettingAllowed(t *testing.T) {
+	for name, want := range map[string]bool{"HideFileExt": true, "hidefileext": true, "Unknown": false} {
+		if got := settingAllowed(name); got != want {
+			t.Errorf("settingAllowed(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      *fakeKey
+		readOnly bool
+		body     string
+		code     int
+		want     []batchResult
+		hidden   uint64
+	}{
+		{
+			"show, set, and status",
+			&fakeKey{hidden: statusHidden},
+			false,
+			`["show", {"command": "set", "name": "HideFileExt", "value": 0}, "status"]`,
+			http.StatusOK,
+			[]batchResult{{Command: batchShow, OK: true}, {Command: batchSet, OK: true}, {Command: batchStatus, OK: true}},
+			statusVisible,
+		},
+		{
+			"unknown value",
+			&fakeKey{hidden: statusHidden},
+			false,
+			`["show", {"command": "set", "name": "Bogus", "value": 1}]`,
+			http.StatusBadRequest,
+			nil,
+			statusHidden,
+		},
+		{
+			"invalid Hidden",
+			&fakeKey{hidden: statusHidden},
+			false,
+			`[{"command": "set", "name": "Hidden", "value": 0}]`,
+			http.StatusBadRequest,
+			nil,
+			statusHidden,
+		},
+		{"unknown command", &fakeKey{hidden: statusHidden}, false, `["toggle"]`, http.StatusBadRequest, nil, statusHidden},
+		{"not an array", &fakeKey{hidden: statusHidden}, false, `"show"`, http.StatusBadRequest, nil, statusHidden},
+		{"empty", &fakeKey{hidden: statusHidden}, false, `[]`, http.StatusBadRequest, nil, statusHidden},
+		{"read-only", &fakeKey{hidden: statusHidden}, true, `["status", "show"]`, http.StatusForbidden, nil, statusHidden},
+		{
+			"failure skips the rest",
+			&fakeKey{hidden: statusHidden, getErr: errors.New("access denied")},
+			false,
+			`["status", "show"]`,
+			http.StatusOK,
+			[]batchResult{{Command: batchStatus, Error: "access denied"}, {Command: batchShow, Skipped: true}},
+			statusHidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			tt.key.sets = make(chan uint32, 8)
+			l := newTestLibrary(tt.key)
+			l.App.Lib = l
+			l.App.Config.ReadOnly = tt.readOnly
+
+			w := httptest.NewRecorder()
+			l.App.handleBatch(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(tt.body)))
+			if w.Code != tt.code {
+				t.Fatalf("handleBatch() code = %d, want %d (%s)", w.Code, tt.code, w.Body)
+			}
+			if tt.key.hidden != tt.hidden {
+				t.Errorf("Hidden = %d, want %d", tt.key.hidden, tt.hidden)
+			}
+			if tt.want == nil {
+				return
+			}
+
+			var got batchResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body, err)
+			}
+			if len(got.Results) != len(tt.want) {
+				t.Fatalf("handleBatch() results = %+v, want %+v", got.Results, tt.want)
+			}
+			wantOk := true
+			for i, want := range tt.want {
+				res := got.Results[i]
+				if res.Command != want.Command || res.OK != want.OK || res.Skipped != want.Skipped ||
+					!strings.Contains(res.Error, want.Error) {
+					t.Errorf("result %d = %+v, want %+v", i, res, want)
+				}
+				wantOk = wantOk && want.OK
+			}
+			if got.OK != wantOk {
+				t.Errorf("handleBatch() ok = %v, want %v", got.OK, wantOk)
+			}
+		})
+	}
+}
+
+func TestANSIStripperSplit(t *testing.T) {
+	var out bytes.Buffer
+	s := &ansiStripper{w: &out}
+	line := "\x1b[36mINFO\x1b[0m[0000] Application started\n"
+
+	// write the line in every possible pair of chunks, as a logBuffer flushing a full buffer may
+	for i := range len(line) + 1 {
+		out.Reset()
+		for _, chunk := range []string{line[:i], line[i:]} {
+			if n, err := s.Write([]byte(chunk)); err != nil || n != len(chunk) {
+				t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+			}
+		}
+		if got, want := out.String(), "INFO[0000] Application started\n"; got != want {
+			t.Errorf("split at %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestStatusLine(t *testing.T) {
+	at := time.Date(2025, 1, 2, 14, 3, 22, 0, time.Local)
+	tests := []struct {
+		value  uint64
+		source string
+		at     time.Time
+		want   string
+	}{
+		{statusVisible, sourceHotkey, at, "Hidden files: VISIBLE (changed via hotkey at 14:03:22)"},
+		{statusHidden, "", at, "Hidden files: HIDDEN (changed at 14:03:22)"},
+		{statusHidden, sourceMenu, time.Time{}, "Hidden files: HIDDEN"},
+	}
+	for _, tt := range tests {
+		if got := statusLine(tt.value, tt.source, tt.at); got != tt.want {
+			t.Errorf("statusLine(%d, %q, %v) = %q, want %q", tt.value, tt.source, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestSetWatcherRunningWithoutTray(t *testing.T) {
+	// as in a service, which never runs the systray but does not set --no-tray either
+	state.Clear()
+	l := newTestLibrary(&fakeKey{hidden: statusHidden})
+	l.App.Config.NoTray = false
+
+	l.setWatcherRunning(false)
+	if running, ok := state.Get[bool]("watcher_running"); !ok || running {
+		t.Errorf("state[watcher_running] = %v, %v, want false, true", running, ok)
+	}
+}
+
+func TestSystrayHiddenRecovers(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    *fakeKey
+		want   uint64
+		wantOk bool
+	}{
+		{"from registry", &fakeKey{hidden: statusHidden}, statusHidden, true},
+		{"read error", &fakeKey{getErr: errors.New("access denied")}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			l := newTestLibrary(tt.key)
+
+			got, ok := l.systrayHidden()
+			if got != tt.want || ok != tt.wantOk {
+				t.Fatalf("systrayHidden() = (%d, %v), want (%d, %v)", got, ok, tt.want, tt.wantOk)
+			}
+			if stored, ok := state.Get[uint64]("status_hidden"); ok != tt.wantOk || stored != tt.want {
+				t.Errorf("state[status_hidden] = (%d, %v), want (%d, %v)", stored, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestSystrayHiddenPrefersState(t *testing.T) {
+	state.Clear()
+	l := newTestLibrary(&fakeKey{getErr: errors.New("not read")})
+	state.Set("status_hidden", statusVisible)
+
+	if got, ok := l.systrayHidden(); got != statusVisible || !ok {
+		t.Errorf("systrayHidden() = (%d, %v), want (%d, true)", got, ok, statusVisible)
+	}
+}
+
+func TestMenuToggleMissing(t *testing.T) {
+	tests := []struct {
+		name     string
+		menu     []string
+		wantWarn bool
+	}{
+		{"menu not built", nil, false},
+		{"left out with --menu", []string{menuAbout, menuQuit}, false},
+		{"in the menu", defaultMenu, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			var out bytes.Buffer
+			l := newTestLibrary(&fakeKey{})
+			l.App.Logger.(*logrus.Logger).SetOutput(&out)
+			l.App.menu = tt.menu
+
+			if _, ok := l.menuToggle(); ok {
+				t.Fatal("menuToggle() = ok, want not ok")
+			}
+			if warned := strings.Contains(out.String(), "menu_toggle"); warned != tt.wantWarn {
+				t.Errorf("menuToggle() warned = %v, want %v (log: %q)", warned, tt.wantWarn, out.String())
+			}
+		})
+	}
+}
+
+func TestViewSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		key  *fakeKey
+		want ViewSettings
+	}{
+		{
+			"all set",
+			&fakeKey{hidden: statusVisible, others: map[string]uint64{"HideFileExt": 0, "ShowSuperHidden": 1}},
+			ViewSettings{Hidden: statusVisible, HideFileExt: 0, ShowSuperHidden: 1},
+		},
+		{
+			"defaults for missing values",
+			&fakeKey{hidden: statusVisible},
+			ViewSettings{Hidden: statusVisible, HideFileExt: 1, ShowSuperHidden: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLibrary(tt.key)
+			got, err := l.ViewSettings()
+			if err != nil {
+				t.Fatalf("ViewSettings() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ViewSettings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewTooltip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  *fakeKey
+		want string
+	}{
+		{
+			"extensions and protected files shown",
+			&fakeKey{hidden: statusVisible, others: map[string]uint64{"HideFileExt": 0, "ShowSuperHidden": 1}},
+			"\nFile extensions: shown\nProtected files: shown",
+		},
+		{
+			"defaults",
+			&fakeKey{hidden: statusVisible},
+			"\nFile extensions: hidden\nProtected files: hidden",
+		},
+		{"read error", &fakeKey{getErr: errors.New("access denied")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state.Clear()
+			l := newTestLibrary(tt.key)
+
+			l.storeViewSettings()
+			if got := viewTooltip(); got != tt.want {
+				t.Errorf("viewTooltip() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestViewSettingsReadError(t *testing.T) {
+	l := newTestLibrary(&fakeKey{getErr: errors.New("access denied")})
+	if _, err := l.ViewSettings(); err == nil {
+		t.Error("ViewSettings() error = nil, want an error")
+	}
+}
+
+func TestFolderRule(t *testing.T) {
+	folders := []string{`C:\dev`, `D:\`}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`C:\dev`, `C:\dev`},
+		{`c:\DEV\`, `C:\dev`},
+		{`C:\dev\project\src`, `C:\dev`},
+		{`C:\development`, ""},
+		{`C:\`, ""},
+		{`D:\src`, `D:\`},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := folderRule(folders, tt.path); got != tt.want {
+			t.Errorf("folderRule(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFileURLPath(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{"file:///C:/dev", `C:\dev`},
+		{"file:///C:/My%20Projects/app", `C:\My Projects\app`},
+		{"file://server/share/dir", `\\server\share\dir`},
+		{"::{20D04FE0-3AEA-1069-A2D8-08002B30309D}", ""},
+		{"https://example.com/", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := fileURLPath(tt.location); got != tt.want {
+			t.Errorf("fileURLPath(%q) = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestParseModifiers(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    []hotkey.Modifier
+		wantErr bool
+	}{
+		{"Ctrl+Alt", []hotkey.Modifier{hotkey.ModCtrl, hotkey.ModAlt}, false},
+		{"shift + win", []hotkey.Modifier{hotkey.ModShift, hotkey.ModWin}, false},
+		{"Alt", []hotkey.Modifier{hotkey.ModAlt}, false},
+		{"Win", []hotkey.Modifier{hotkey.ModWin}, false},
+		{"Ctrl", nil, true},
+		{"Shift", nil, true},
+		{"Ctrl+Ctrl", nil, true},
+		{"Ctrl+Meta", nil, true},
+		{"", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseModifiers(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseModifiers(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseModifiers(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+// fakeWindows is a WindowAPI with n top-level windows, every other one of which is a File Explorer window with two
+// tabs (and a child window that is not a tab).
+type fakeWindows struct {
+	n      int
+	posted atomic.Int64
+}
+
+func (w *fakeWindows) EnumWindows(visit func(hwnd winapi.HWND) bool) error {
+	for i := 1; i <= w.n; i++ {
+		if !visit(winapi.HWND(i)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (w *fakeWindows) EnumChildWindows(hwnd winapi.HWND, visit func(child winapi.HWND) bool) error {
+	if hwnd%2 != 0 {
+		return nil
+	}
+	for i := 1; i <= 3; i++ {
+		if !visit(hwnd*1000 + winapi.HWND(i)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (w *fakeWindows) ClassName(hwnd winapi.HWND) string {
+	switch {
+	case hwnd > 1000 && hwnd%1000 == 3:
+		return "DirectUIHWND"
+	case hwnd > 1000:
+		return explorerTabClass
+	case hwnd%2 == 0:
+		return "CabinetWClass"
+	}
+	return "Shell_TrayWnd"
+}
+
+func (w *fakeWindows) Text(hwnd winapi.HWND) string {
+	return fmt.Sprintf("Window %d", hwnd)
+}
+
+func (w *fakeWindows) Process(hwnd winapi.HWND) (uint32, string, error) {
+	return uint32(hwnd), explorerPaths()[0], nil
+}
+
+func (w *fakeWindows) PostMessage(winapi.HWND, uint32, winapi.WPARAM, winapi.LPARAM) error {
+	w.posted.Add(1)
+	return nil
+}
+
+func TestRefreshExplorerWindowsFake(t *testing.T) {
+	l := newTestLibrary(&fakeKey{})
+	fake := &fakeWindows{n: 10}
+	l.Windows = fake
+
+	if got := l.RefreshExplorerWindows(); got != 5 {
+		t.Errorf("RefreshExplorerWindows() = %d, want 5", got)
+	}
+	want := int64(5)
+	if hasExplorerTabs() {
+		want += 10
+	}
+	if got := fake.posted.Load(); got != want {
+		t.Errorf("posted %d refresh messages, want %d", got, want)
+	}
+}
+
+func BenchmarkRefreshExplorerWindows(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("windows=%d", n), func(b *testing.B) {
+			l := newTestLibrary(&fakeKey{})
+			l.Windows = &fakeWindows{n: n}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				l.RefreshExplorerWindows()
+			}
+		})
+	}
+}
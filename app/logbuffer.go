@@ -0,0 +1,106 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logBufferSize is the number of bytes buffered before log output is flushed regardless of the interval.
+const logBufferSize = 64 * 1024
+
+// logBuffer is an io.Writer that batches log output in memory and writes it to the underlying writer
+// on a fixed interval, when the buffer fills up, or after an urgent entry has been written.
+// It is safe for concurrent use.
+type logBuffer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	urgent bool
+	done   chan struct{}
+	once   sync.Once
+}
+
+// newLogBuffer creates a logBuffer that wraps w and starts a goroutine flushing it every interval.
+// The buffer must be closed with Close to stop the goroutine and flush any remaining output.
+func newLogBuffer(w io.Writer, interval time.Duration) *logBuffer {
+	b := &logBuffer{
+		w:    bufio.NewWriterSize(w, logBufferSize),
+		done: make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				_ = b.Flush()
+			case <-b.done:
+				return
+			}
+		}
+	}()
+
+	return b
+}
+
+// Write buffers p. If the entry being written was marked urgent, the buffer is flushed immediately afterwards.
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n, err := b.w.Write(p)
+	if err == nil && b.urgent {
+		err = b.w.Flush()
+	}
+	b.urgent = false
+
+	return n, err
+}
+
+// Flush writes any buffered output to the underlying writer.
+func (b *logBuffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.w.Flush()
+}
+
+// Close stops the periodic flushing and flushes any remaining output. It is safe to call more than once.
+func (b *logBuffer) Close() error {
+	b.once.Do(func() { close(b.done) })
+	return b.Flush()
+}
+
+// markUrgent causes the next write to be flushed as soon as it is buffered.
+func (b *logBuffer) markUrgent() {
+	b.mu.Lock()
+	b.urgent = true
+	b.mu.Unlock()
+}
+
+// flushingFormatter wraps a logrus.Formatter and marks entries at ERROR level or above as urgent
+// so they are flushed through the logBuffer without waiting for the interval. This relies on logrus
+// formatting and writing each entry while holding the logger's lock, so the next write is the formatted entry.
+type flushingFormatter struct {
+	logrus.Formatter
+	buffer *logBuffer
+}
+
+// Format marks the buffer as urgent for entries at ERROR level or above, then delegates to the wrapped formatter.
+func (f *flushingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Level <= logrus.ErrorLevel {
+		f.buffer.markUrgent()
+	}
+
+	return f.Formatter.Format(entry)
+}
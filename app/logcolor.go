@@ -0,0 +1,79 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+
+	"golang.org/x/sys/windows"
+)
+
+// Log color modes selectable with --log-color.
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// ansiEscape matches the ANSI escape sequences that logrus.TextFormatter uses to color its output, and ansiPartial
+// matches the start of one that was cut off at the end of a write.
+var (
+	ansiEscape  = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	ansiPartial = regexp.MustCompile("^\x1b(\\[[0-9;]*)?$")
+)
+
+// ansiStripper is an io.Writer that removes ANSI color escape sequences before writing to w, so that a log file
+// sharing the colored output written to the console stays plain text. An escape sequence split across writes (e.g.,
+// when a logBuffer flushes a full buffer with --log-buffer) is held back until the write completing it.
+type ansiStripper struct {
+	w       io.Writer
+	pending []byte // start of an escape sequence that ended the previous write
+}
+
+// Write writes p to the underlying writer without its ANSI escape sequences.
+// It reports len(p) as written on success, since the caller is not concerned with the bytes that were removed.
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	b := append(s.pending, p...)
+	s.pending = nil
+	if i := bytes.LastIndexByte(b, '\x1b'); i >= 0 && ansiPartial.Match(b[i:]) {
+		b, s.pending = b[:i], slices.Clone(b[i:])
+	}
+
+	if _, err := s.w.Write(ansiEscape.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// logColors reports whether log output written to f (the console) is colored, as selected with --log-color:
+// always with "always", never with "never", and with "auto" only if f is a console. Unless colors are disabled,
+// ANSI escape sequences are enabled for the console, and colors are only used if that succeeds or f is not a
+// console (e.g., a pipe to a program that understands them).
+//
+// Parameters:
+//
+//	f - The file the log is written to, typically os.Stderr.
+func logColors(f *os.File) bool {
+	if flag.LogColor == colorNever {
+		return false
+	}
+
+	var mode uint32
+	handle := windows.Handle(f.Fd())
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return flag.LogColor == colorAlways
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
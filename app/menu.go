@@ -0,0 +1,73 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/getlantern/systray"
+)
+
+// Items of the tray menu, as listed with --menu.
+const (
+	menuToggle          = "toggle"
+	menuTemporary       = "temporary"
+	menuUndo            = "undo"
+	menuRedo            = "redo"
+	menuCancelTemporary = "cancel-temporary"
+	menuAdvanced        = "advanced"
+	menuAbout           = "about"
+	menuReportBug       = "report-bug"
+	menuSeparator       = "separator"
+	menuQuit            = "quit"
+)
+
+// defaultMenu is the layout of the tray menu when --menu is not set.
+var defaultMenu = []string{
+	menuToggle, menuTemporary, menuUndo, menuRedo, menuCancelTemporary,
+	menuSeparator, menuAdvanced, menuAbout, menuReportBug, menuQuit,
+}
+
+// menuLayout returns the items of the tray menu in order, as listed with --menu (or defaultMenu if it is not set).
+// Names are matched case-insensitively. Unknown and repeated items (other than separators) are ignored with a
+// warning, and Quit is appended if it is not listed, so that the application can always be quit from the tray.
+//
+// Parameters:
+//
+//	items - The names of the items, in order.
+func menuLayout(items []string) []string {
+	if len(items) == 0 {
+		return defaultMenu
+	}
+
+	layout := make([]string, 0, len(items)+1)
+	for _, item := range items {
+		item = strings.ToLower(strings.TrimSpace(item))
+		switch {
+		case !slices.Contains(defaultMenu, item):
+			log.Warnf("Ignoring unknown menu item %q", item)
+		case item != menuSeparator && slices.Contains(layout, item):
+			log.Warnf("Ignoring repeated menu item %q", item)
+		default:
+			layout = append(layout, item)
+		}
+	}
+	if !slices.Contains(layout, menuQuit) {
+		layout = append(layout, menuQuit)
+	}
+
+	return layout
+}
+
+// clicked returns the channel that receives the clicks of item, or nil if the item is not in the menu,
+// so that selecting on it blocks forever.
+func clicked(item *systray.MenuItem) <-chan struct{} {
+	if item == nil {
+		return nil
+	}
+	return item.ClickedCh
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// onToggleTimeout is how long the command given with --on-toggle may run before it is killed.
+const onToggleTimeout = 30 * time.Second
+
+// runOnToggle runs the command given with --on-toggle (if any) through cmd.exe after a successful toggle,
+// without waiting for it to finish. The new state is appended to the command line as "visible" or "hidden"
+// and is also available in the SHOWALLFILES_HIDDEN environment variable as the raw "Hidden" value.
+// The command runs without a console window, in a job object (see newKillOnCloseJob) that is closed after
+// onToggleTimeout, so that the command and every process it started are killed if still running by then.
+// Its exit status is logged.
+//
+// Parameters:
+//
+//	value - The value of "Hidden" that was written.
+func (l *Library) runOnToggle(value uint64) {
+	command := l.App.Config.OnToggle
+	if command == "" {
+		return
+	}
+
+	status := "visible"
+	if value == statusHidden {
+		status = "hidden"
+	}
+
+	job, err := newKillOnCloseJob()
+	if err != nil {
+		l.App.Logger.Errorf("Could not run --on-toggle command: %v", err)
+		return
+	}
+
+	comspec := filepath.Join(os.Getenv("SystemRoot"), "System32", "cmd.exe")
+	cmd := exec.Command(comspec)
+	// cmd.exe parses its command line itself, so it is passed verbatim rather than quoted as separate arguments
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine:       fmt.Sprintf(`"%s" /C %s %s`, comspec, command, status),
+		CreationFlags: windows.CREATE_NO_WINDOW,
+		HideWindow:    true,
+	}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("SHOWALLFILES_HIDDEN=%d", value))
+
+	var killed atomic.Bool
+	l.App.Logger.Debugf("Running --on-toggle command %q with %q", command, status)
+	err = startCommand(cmd, func(err error) {
+		var exitErr *exec.ExitError
+		switch {
+		case killed.Load():
+			l.App.Logger.Warnf("The --on-toggle command was killed after running for %s", onToggleTimeout)
+		case errors.As(err, &exitErr):
+			l.App.Logger.Warnf("The --on-toggle command exited with status %d", exitErr.ExitCode())
+		case err != nil:
+			l.App.Logger.Warnf("The --on-toggle command failed: %v", err)
+		default:
+			l.App.Logger.Debugf("The --on-toggle command exited with status 0")
+		}
+	})
+	if err != nil {
+		_ = windows.CloseHandle(job)
+		l.App.Logger.Errorf("Could not run --on-toggle command: %v", err)
+		return
+	}
+	if err = assignJob(job, cmd.Process.Pid); err != nil {
+		l.App.Logger.Warnf("Processes started by the --on-toggle command will not be killed with it: %v", err)
+	}
+
+	time.AfterFunc(onToggleTimeout, func() {
+		killed.Store(true)
+		_ = cmd.Process.Kill() // in case it could not be assigned to the job; fails harmlessly if it exited
+		_ = windows.CloseHandle(job)
+	})
+}
+
+// newKillOnCloseJob creates a job object whose processes are all terminated once its last handle is closed.
+func newKillOnCloseJob() (windows.Handle, error) {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed call to CreateJobObject: %v", err)
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err = windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		_ = windows.CloseHandle(job)
+		return 0, fmt.Errorf("failed call to SetInformationJobObject: %v", err)
+	}
+
+	return job, nil
+}
+
+// assignJob assigns the process with the given ID to job. Processes it started before are not assigned.
+//
+// Parameters:
+//
+//	job - The job object (see newKillOnCloseJob).
+//	pid - The ID of the process.
+func assignJob(job windows.Handle, pid int) error {
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		return fmt.Errorf("failed call to OpenProcess: %v", err)
+	}
+	defer func() { _ = windows.CloseHandle(process) }()
+
+	if err = windows.AssignProcessToJobObject(job, process); err != nil {
+		return fmt.Errorf("failed call to AssignProcessToJobObject: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats selectable with --output (and --print-config).
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// output is the result of a diagnostic command (e.g., --status or --dump-windows), as printed by writeOutput.
+// JSON is the value marshalled with --output=json, while Header and Rows are the columns and cells of the table
+// printed otherwise, which usually present the same data in a more readable way.
+type output struct {
+	JSON   any
+	Header []string
+	Rows   [][]any
+}
+
+// outputFormat returns the format selected with --output, or def if it was not set anywhere (see configSources),
+// for commands whose output defaults to JSON (e.g., --export-settings, whose output can be imported again).
+//
+// Parameters:
+//
+//	def - The format to use unless --output was set.
+func outputFormat(def string) string {
+	if _, ok := configSources["output"]; ok {
+		return flag.Output
+	}
+
+	return def
+}
+
+// writeOutput writes out to w in the given format: indented JSON of out.JSON, followed by a newline, for
+// outputJSON, and otherwise a table of out.Header and out.Rows with aligned columns, formatting cells with %v.
+// Returns an error if out.JSON cannot be encoded or w cannot be written.
+//
+// Parameters:
+//
+//	w      - Receives the output (e.g., os.Stdout).
+//	format - The output format: outputTable or outputJSON.
+//	out    - The output to write.
+func writeOutput(w io.Writer, format string, out output) error {
+	if format == outputJSON {
+		b, err := json.MarshalIndent(out.JSON, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode output: %v", err)
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(out.Header, "\t"))
+	for _, row := range out.Rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = fmt.Sprint(cell)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+
+	return tw.Flush()
+}
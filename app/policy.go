@@ -0,0 +1,86 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"time"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// policyRevertWindow is how long after a toggle is written a change back to the previous value is attributed
+	// to a policy overriding the setting rather than to the user.
+	policyRevertWindow = 2 * time.Second
+
+	// policyCooldown is how long toggles are refused after an override was detected, to avoid fighting the policy.
+	policyCooldown = 30 * time.Second
+
+	// policyKeyPath is the registry key holding Explorer policies, under both HKEY_CURRENT_USER and HKEY_LOCAL_MACHINE.
+	policyKeyPath = `Software\Microsoft\Windows\CurrentVersion\Policies\Explorer`
+)
+
+// checkPolicyOverride is called by applyHidden with every value seen by the registry watchers. If the value differs
+// from the one written by a toggle within the last policyRevertWindow (see commitToggle), the setting is assumed to
+// be enforced by a policy: a warning is logged, the user is informed with a message box unless the systray is
+// unavailable (Config.NoTray), and further toggles are refused for policyCooldown.
+//
+// Parameters:
+//
+//	value - The value of "Hidden" seen by the registry watcher.
+func (l *Library) checkPolicyOverride(value uint64) {
+	written, ok := state.Get[uint64]("toggle_written")
+	if !ok || written == value {
+		return
+	}
+	state.Delete("toggle_written")
+	state.SetTTL("policy_cooldown", true, policyCooldown, nil)
+
+	l.App.Logger.Warnf("Toggle to %d was reverted to %d; the setting appears to be enforced by a policy", written, value)
+	if l.App.Config.NoTray {
+		// nobody may be there to dismiss a message box (e.g., in the service or a program embedding the package)
+		return
+	}
+
+	msg := "The visibility of hidden files was changed back right after " + l.App.Meta.Name + " changed it, " +
+		"so it appears to be enforced by a policy on this computer."
+	if l.policyNoFolderOptions() {
+		msg += "\n\nThe \"NoFolderOptions\" policy is set, which prevents changing folder options."
+	}
+	msg += "\n\nContact your administrator to change this setting."
+
+	msgbox("Setting Enforced by Policy", msg, windows.MB_OK|windows.MB_ICONWARNING|windows.MB_SETFOREGROUND, -1)
+}
+
+// policyCoolingDown reports whether toggles are currently refused because a policy override was recently detected.
+func policyCoolingDown() bool {
+	cooling, _ := state.Get[bool]("policy_cooldown")
+	return cooling
+}
+
+// policyNoFolderOptions reports whether the "NoFolderOptions" Explorer policy is set for the user (see userKey) or
+// the machine.
+func (l *Library) policyNoFolderOptions() bool {
+	userRoot, userPath := l.userKey(policyKeyPath)
+	for _, root := range []struct {
+		key  registry.Key
+		path string
+	}{{userRoot, userPath}, {registry.LOCAL_MACHINE, policyKeyPath}} {
+		key, err := registry.OpenKey(root.key, root.path, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		value, _, err := key.GetIntegerValue("NoFolderOptions")
+		_ = key.Close()
+		if err == nil && value != 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/kamaranl/winapi"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// idYes is the value returned by MessageBox when the "Yes" button is selected.
+	idYes = 6
+
+	// cfUnicodeText is the clipboard format for UTF-16 text.
+	cfUnicodeText = 13
+
+	// flashwTray flashes the taskbar button of a window (FLASHW_TRAY).
+	flashwTray = 0x0002
+
+	// gmemMoveable allocates movable global memory, as required for clipboard data.
+	gmemMoveable = 0x0002
+
+	// wmKeyDown and wmKeyUp are posted to simulate a key press in another window.
+	wmKeyDown = 0x0100
+	wmKeyUp   = 0x0101
+
+	// defaultDPI is the DPI at 100% display scaling.
+	defaultDPI = 96
+
+	// imageFileMachineArm64 is the native machine type of Windows on ARM (IMAGE_FILE_MACHINE_ARM64).
+	imageFileMachineArm64 = 0xAA64
+
+	// hwndBroadcast sends a message to all top-level windows (HWND_BROADCAST).
+	hwndBroadcast = 0xFFFF
+
+	// wmSettingChange notifies windows that a system-wide setting changed (WM_SETTINGCHANGE).
+	wmSettingChange = 0x001A
+
+	// smtoAbortIfHung makes SendMessageTimeout skip windows that stopped responding instead of waiting for them.
+	smtoAbortIfHung = 0x0002
+
+	// dpiAwarenessContextSystemAware makes the process aware of the system DPI (DPI_AWARENESS_CONTEXT_SYSTEM_AWARE).
+	dpiAwarenessContextSystemAware = ^uintptr(1)
+)
+
+// Win32 procedures used by the application that are not wrapped by the winapi module.
+var (
+	gdi32    = windows.NewLazySystemDLL("gdi32.dll")
+	kernel32 = windows.NewLazySystemDLL("kernel32.dll")
+	ole32    = windows.NewLazySystemDLL("ole32.dll")
+	oleaut32 = windows.NewLazySystemDLL("oleaut32.dll")
+	user32   = windows.NewLazySystemDLL("user32.dll")
+
+	procGetProcessHandleCount = kernel32.NewProc("GetProcessHandleCount")
+	procGlobalAlloc           = kernel32.NewProc("GlobalAlloc")
+	procGlobalFree            = kernel32.NewProc("GlobalFree")
+	procGlobalLock            = kernel32.NewProc("GlobalLock")
+	procGlobalUnlock          = kernel32.NewProc("GlobalUnlock")
+	procRtlMoveMemory         = kernel32.NewProc("RtlMoveMemory")
+
+	procCreateSolidBrush = gdi32.NewProc("CreateSolidBrush")
+	procDeleteObject     = gdi32.NewProc("DeleteObject")
+	procGetStockObject   = gdi32.NewProc("GetStockObject")
+	procSelectObject     = gdi32.NewProc("SelectObject")
+	procSetBkMode        = gdi32.NewProc("SetBkMode")
+	procSetTextColor     = gdi32.NewProc("SetTextColor")
+
+	procCoCreateInstance = ole32.NewProc("CoCreateInstance")
+	procSysFreeString    = oleaut32.NewProc("SysFreeString")
+	procVariantClear     = oleaut32.NewProc("VariantClear")
+
+	procBeginPaint                 = user32.NewProc("BeginPaint")
+	procCallWindowProcW            = user32.NewProc("CallWindowProcW")
+	procCloseClipboard             = user32.NewProc("CloseClipboard")
+	procCreateWindowExW            = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW             = user32.NewProc("DefWindowProcW")
+	procDrawTextW                  = user32.NewProc("DrawTextW")
+	procEmptyClipboard             = user32.NewProc("EmptyClipboard")
+	procEndPaint                   = user32.NewProc("EndPaint")
+	procEnumChildWindows           = user32.NewProc("EnumChildWindows")
+	procEnumWindows                = user32.NewProc("EnumWindows")
+	procFillRect                   = user32.NewProc("FillRect")
+	procFindWindowExW              = user32.NewProc("FindWindowExW")
+	procFlashWindowEx              = user32.NewProc("FlashWindowEx")
+	procGetClientRect              = user32.NewProc("GetClientRect")
+	procGetDoubleClickTime         = user32.NewProc("GetDoubleClickTime")
+	procGetDpiForSystem            = user32.NewProc("GetDpiForSystem")
+	procGetSystemMetrics           = user32.NewProc("GetSystemMetrics")
+	procGetWindowTextW             = user32.NewProc("GetWindowTextW")
+	procInvalidateRect             = user32.NewProc("InvalidateRect")
+	procIsHungAppWindow            = user32.NewProc("IsHungAppWindow")
+	procIsWindow                   = user32.NewProc("IsWindow")
+	procKillTimer                  = user32.NewProc("KillTimer")
+	procMessageBeep                = user32.NewProc("MessageBeep")
+	procOpenClipboard              = user32.NewProc("OpenClipboard")
+	procPostQuitMessage            = user32.NewProc("PostQuitMessage")
+	procRegisterClassExW           = user32.NewProc("RegisterClassExW")
+	procSendMessageTimeoutW        = user32.NewProc("SendMessageTimeoutW")
+	procSetClipboardData           = user32.NewProc("SetClipboardData")
+	procSetLayeredWindowAttributes = user32.NewProc("SetLayeredWindowAttributes")
+	procSetTimer                   = user32.NewProc("SetTimer")
+	procSetWindowLongPtrW          = user32.NewProc("SetWindowLongPtrW")
+	procShowWindow                 = user32.NewProc("ShowWindow")
+	procUnregisterClassW           = user32.NewProc("UnregisterClassW")
+
+	procSetProcessDpiAwarenessContext = user32.NewProc("SetProcessDpiAwarenessContext")
+)
+
+// flashWInfo mirrors the Win32 FLASHWINFO structure passed to FlashWindowEx.
+type flashWInfo struct {
+	cbSize    uint32
+	hwnd      winapi.HWND
+	dwFlags   uint32
+	uCount    uint32
+	dwTimeout uint32
+}
+
+// explorerTabClass is the class name of the child window hosting each tab of a File Explorer window.
+const explorerTabClass = "ShellTabWindowClass"
+
+// explorerTabsBuild is the first build of Windows 11 (22H2) whose File Explorer has tabs.
+const explorerTabsBuild = 22621
+
+// hasExplorerTabs reports whether File Explorer has tabs on this version of Windows.
+// The result is computed once, since the version cannot change while the application runs.
+var hasExplorerTabs = sync.OnceValue(func() bool {
+	return windows.RtlGetVersion().BuildNumber >= explorerTabsBuild
+})
+
+// explorerPaths returns the paths of the explorer.exe images that File Explorer windows can belong to: the one in the
+// Windows directory, the 32-bit one that 64-bit Windows ships in SysWOW64, and on Windows on ARM, the ARM32 one in
+// SysArm32. The Windows directory is queried from the system, falling back to %SystemRoot%, since the variable is
+// not always inherited as expected by x86 and x64 programs emulated on ARM64 (e.g., when started by a launcher).
+// The result is computed once, since none of this can change while the application runs.
+var explorerPaths = sync.OnceValue(func() []string {
+	dir, err := windows.GetSystemWindowsDirectory()
+	if err != nil || dir == "" {
+		dir = os.Getenv("SystemRoot")
+	}
+
+	paths := []string{
+		filepath.Join(dir, "explorer.exe"),
+		filepath.Join(dir, "SysWOW64", "explorer.exe"),
+	}
+	var processMachine, nativeMachine uint16
+	if err = windows.IsWow64Process2(windows.CurrentProcess(), &processMachine, &nativeMachine); err == nil &&
+		nativeMachine == imageFileMachineArm64 {
+		paths = append(paths, filepath.Join(dir, "SysArm32", "explorer.exe"))
+	}
+
+	return paths
+})
+
+// setDPIAware makes the process aware of the system DPI, so that systemDPI reports the actual DPI instead of
+// defaultDPI and message boxes are not bitmap-scaled. It must be called before any window is created.
+// Returns an error if the call fails or is not available (before Windows 10, version 1703).
+func setDPIAware() error {
+	if err := procSetProcessDpiAwarenessContext.Find(); err != nil {
+		return err
+	}
+	if r1, _, err := procSetProcessDpiAwarenessContext.Call(dpiAwarenessContextSystemAware); r1 == 0 {
+		return fmt.Errorf("failed call to SetProcessDpiAwarenessContext: %v", err)
+	}
+
+	return nil
+}
+
+// systemDPI returns the system DPI, or defaultDPI if it cannot be determined (before Windows 10, version 1607).
+// The result is computed once, since the system DPI only changes when the user signs in again.
+var systemDPI = sync.OnceValue(func() uint32 {
+	if procGetDpiForSystem.Find() != nil {
+		return defaultDPI
+	}
+	if dpi, _, _ := procGetDpiForSystem.Call(); dpi != 0 {
+		return uint32(dpi)
+	}
+
+	return defaultDPI
+})
+
+// className returns the class name of the specified window, or an empty string if it cannot be retrieved.
+func className(hwnd winapi.HWND) string {
+	classNameW := make([]uint16, windows.MAX_PATH)
+	if _, err := windows.GetClassName(hwnd, &classNameW[0], int32(len(classNameW))); err != nil {
+		return ""
+	}
+
+	return windows.UTF16ToString(classNameW)
+}
+
+// processHandleCount returns the number of handles currently open by this process, or 0 if it cannot be determined.
+func processHandleCount() uint32 {
+	var count uint32
+	r1, _, _ := procGetProcessHandleCount.Call(uintptr(windows.CurrentProcess()), uintptr(unsafe.Pointer(&count)))
+	if r1 == 0 {
+		return 0
+	}
+
+	return count
+}
+
+// messageBeep plays the default system sound.
+func messageBeep() error {
+	if r1, _, err := procMessageBeep.Call(windows.MB_OK); r1 == 0 {
+		return fmt.Errorf("failed call to MessageBeep: %v", err)
+	}
+
+	return nil
+}
+
+// broadcastSettingChange sends WM_SETTINGCHANGE for "ShellState" to all top-level windows, so that shell components
+// other than File Explorer windows (e.g., the desktop) re-read the hidden files setting. It uses SendMessageTimeout
+// with SMTO_ABORTIFHUNG, so hung windows are skipped and no window is waited on for longer than timeout.
+// Returns an error wrapping windows.ERROR_TIMEOUT if the broadcast timed out.
+//
+// Parameters:
+//
+//	timeout - How long to wait for each window to process the message.
+func broadcastSettingChange(timeout time.Duration) error {
+	var result uintptr
+	r1, _, err := procSendMessageTimeoutW.Call(
+		hwndBroadcast,
+		wmSettingChange,
+		0,
+		uintptr(unsafe.Pointer(windows.StringToUTF16Ptr("ShellState"))),
+		smtoAbortIfHung,
+		uintptr(timeout.Milliseconds()),
+		uintptr(unsafe.Pointer(&result)),
+	)
+	if r1 == 0 {
+		return fmt.Errorf("failed call to SendMessageTimeoutW: %w", err)
+	}
+
+	return nil
+}
+
+// flashWindow flashes the taskbar button of the specified window the given number of times.
+func flashWindow(hwnd winapi.HWND, count uint32) {
+	info := flashWInfo{hwnd: hwnd, dwFlags: flashwTray, uCount: count}
+	info.cbSize = uint32(unsafe.Sizeof(info))
+	// the return value only indicates whether the window was active before the call
+	_, _, _ = procFlashWindowEx.Call(uintptr(unsafe.Pointer(&info)))
+}
+
+// windowProcess returns the ID and the executable path of the process that created the specified window.
+// The path is empty, and an error returned, if the process cannot be queried. If the process runs elevated
+// while this one does not, the error wraps windows.ERROR_ACCESS_DENIED.
+func windowProcess(hwnd winapi.HWND) (pid uint32, exe string, err error) {
+	if _, err = windows.GetWindowThreadProcessId(hwnd, &pid); err != nil {
+		return 0, "", fmt.Errorf("failed call to GetWindowThreadProcessId: %v", err)
+	}
+
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
+	if err != nil {
+		return pid, "", fmt.Errorf("failed call to OpenProcess: %w", err)
+	}
+	defer func() { _ = windows.CloseHandle(handle) }()
+
+	exeW := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(exeW))
+	if err = windows.QueryFullProcessImageName(handle, 0, &exeW[0], &size); err != nil {
+		return pid, "", fmt.Errorf("failed call to QueryFullProcessImageName: %v", err)
+	}
+
+	return pid, filepath.Clean(windows.UTF16ToString(exeW[:size])), nil
+}
+
+// isHungAppWindow reports whether the specified window has stopped responding to messages.
+func isHungAppWindow(hwnd winapi.HWND) bool {
+	r1, _, _ := procIsHungAppWindow.Call(uintptr(hwnd))
+	return r1 != 0
+}
+
+// isWindow reports whether the specified window handle identifies an existing window.
+func isWindow(hwnd winapi.HWND) bool {
+	r1, _, _ := procIsWindow.Call(uintptr(hwnd))
+	return r1 != 0
+}
+
+// windowText returns the title of the specified window, or an empty string if it has none.
+func windowText(hwnd winapi.HWND) string {
+	textW := make([]uint16, windows.MAX_PATH)
+	r1, _, _ := procGetWindowTextW.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&textW[0])), uintptr(len(textW)))
+	if r1 == 0 {
+		return ""
+	}
+
+	return windows.UTF16ToString(textW)
+}
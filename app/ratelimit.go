@@ -0,0 +1,72 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// warnInterval is how often the same rate-limited warning may be logged.
+const warnInterval = time.Minute
+
+// rateLimiter limits how often identical messages are logged, so that sustained failures (e.g., posting to every
+// window on every refresh while Explorer is unresponsive) do not flood the log. Messages are identical when they
+// format to the same text. The zero value is ready to use and limits messages to one per warnInterval.
+type rateLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*rateLimitEntry
+}
+
+// rateLimitEntry tracks when a message was last logged and how many times it was suppressed since.
+type rateLimitEntry struct {
+	last       time.Time
+	suppressed int
+}
+
+// Warnf logs a warning through logger unless the same warning was already logged within the last warnInterval,
+// in which case it is only counted. The next time the warning is logged, the number of suppressed repetitions
+// is appended to it.
+//
+// Parameters:
+//
+//	logger - The Logger to log the warning through.
+//	format - The format of the warning, as for Logger.Warnf.
+//	args   - The arguments for format.
+func (r *rateLimiter) Warnf(logger Logger, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	now := time.Now()
+
+	r.mu.Lock()
+	if r.entries == nil {
+		r.entries = map[string]*rateLimitEntry{}
+	}
+	entry, ok := r.entries[msg]
+	if ok && now.Sub(entry.last) < warnInterval {
+		entry.suppressed++
+		r.mu.Unlock()
+		return
+	}
+
+	var suppressed int
+	if ok {
+		suppressed = entry.suppressed
+	}
+	r.entries[msg] = &rateLimitEntry{last: now}
+	for key, e := range r.entries {
+		if now.Sub(e.last) >= warnInterval && e.suppressed == 0 {
+			delete(r.entries, key)
+		}
+	}
+	r.mu.Unlock()
+
+	if suppressed > 0 {
+		logger.Warnf("%s (suppressed %d more times)", msg, suppressed)
+		return
+	}
+	logger.Warnf("%s", msg)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	runtimedebug "runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// watcherRestarts is how many times a long-running background goroutine (e.g., the registry watcher)
+	// is restarted after a panic before it is given up on.
+	watcherRestarts = 3
+
+	// panicRestartDelay is how long goSafe waits before restarting a goroutine that panicked,
+	// so that a goroutine panicking right away does not spin.
+	panicRestartDelay = time.Second
+)
+
+// goSafe runs fn in a new goroutine, recovering from any panic in it so that a bug in one background task does not
+// crash the whole application. The panic is logged along with its stack, after which fn is run again, up to
+// restarts times; one-shot goroutines pass 0 so that they are never restarted. A normal return of fn is final.
+//
+// Parameters:
+//
+//	logger   - Receives the panic and restart messages.
+//	name     - Describes the goroutine in the log (e.g., "registry watcher").
+//	restarts - How many times fn is restarted after a panic.
+//	fn       - The body of the goroutine.
+func goSafe(logger Logger, name string, restarts int, fn func()) {
+	go runSafe(logger, name, restarts, fn)
+}
+
+// goTracked is like goSafe, but adds the goroutine to wg until it returned for good (i.e., without being restarted),
+// so that it can be waited for on shutdown (see Application.waitWorkers).
+//
+// Parameters:
+//
+//	wg       - Tracks the goroutine.
+//	logger   - Receives the panic and restart messages.
+//	name     - Describes the goroutine in the log (e.g., "registry watcher").
+//	restarts - How many times fn is restarted after a panic.
+//	fn       - The body of the goroutine.
+func goTracked(wg *sync.WaitGroup, logger Logger, name string, restarts int, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runSafe(logger, name, restarts, fn)
+	}()
+}
+
+// runSafe implements goSafe and goTracked, running fn and restarting it after a panic up to restarts times.
+func runSafe(logger Logger, name string, restarts int, fn func()) {
+	for attempt := 0; runRecovered(logger, name, fn); attempt++ {
+		if attempt >= restarts {
+			if restarts > 0 {
+				logger.Errorf("Not restarting %s after %d restarts", name, restarts)
+			}
+			return
+		}
+		logger.Warnf("Restarting %s in %s", name, panicRestartDelay)
+		time.Sleep(panicRestartDelay)
+	}
+}
+
+// runRecovered calls fn and reports whether it panicked, in which case the panic is logged along with its stack.
+func runRecovered(logger Logger, name string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = true
+			logger.Errorf("Recovered from panic in %s: %v\n%s", name, r, runtimedebug.Stack())
+		}
+	}()
+
+	fn()
+	return false
+}
+
+// recoverCallback recovers from a panic in a callback invoked by Windows (e.g., winEventProc), which must not
+// unwind into the calling system code, and logs it along with its stack. It must be deferred by the callback, which
+// then returns 0 (the zero value of its result).
+func recoverCallback(logger Logger, name string) {
+	if r := recover(); r != nil {
+		logger.Errorf("Recovered from panic in %s: %v\n%s", name, r, runtimedebug.Stack())
+	}
+}
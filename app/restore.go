@@ -0,0 +1,96 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"golang.org/x/sys/windows"
+)
+
+// prepareRestore must be called once "status_hidden" holds the value read at startup. If a previous session
+// started with --restore-on-exit did not exit cleanly (i.e., its "original_hidden" entry was still persisted),
+// the user is offered to restore that value now. Then, if --restore-on-exit is set, the current value is
+// recorded as "original_hidden" and persisted immediately so that it survives a crash.
+func (a *Application) prepareRestore() {
+	if original, ok := state.Get[uint64]("original_hidden"); ok {
+		state.Delete("original_hidden")
+		current, _ := state.Get[uint64]("status_hidden")
+		if original != current && confirm("Restore Setting",
+			"The previous session of "+a.Meta.Name+" ended unexpectedly before restoring the visibility of hidden files.\n\n"+
+				"Restore it to how it was before that session?", windows.MB_ICONQUESTION) {
+			a.Logger.Infof("Restoring 'Hidden' value %d left by the previous session", original)
+			if err := a.Lib.SetHidden(original); err != nil {
+				a.Logger.Errorf("Could not restore 'Hidden' value: %v", err)
+			}
+		}
+	}
+
+	if flag.RestoreOnExit {
+		if value, ok := state.Get[uint64]("status_hidden"); ok {
+			a.Logger.Debugf("Recording 'Hidden' value %d to restore on exit", value)
+			state.Set("original_hidden", value)
+		}
+	}
+	saveState(a.Meta.Name)
+}
+
+// restoreOriginal writes the "Hidden" value recorded by prepareRestore back to the registry and refreshes
+// File Explorer windows (unless --no-refresh is set), undoing any changes made during the session. The record is
+// removed afterwards so that the next run does not offer to restore it again. Does nothing if no value was recorded.
+func (a *Application) restoreOriginal() error {
+	original, ok := state.Get[uint64]("original_hidden")
+	if !ok {
+		return nil
+	}
+	state.Delete("original_hidden")
+
+	a.Logger.Infof("Restoring 'Hidden' value %d from startup", original)
+	if err := a.setHidden(original, exitSource()); err != nil {
+		return fmt.Errorf("failed to restore 'Hidden': %v", err)
+	}
+	if !a.Config.NoWatch && !a.Lib.WatcherRunning() {
+		// with --no-watch, SetHidden already refreshed the windows, and a running watcher refreshes them itself
+		a.refreshAfterWrite()
+	}
+
+	return nil
+}
+
+// applyStartupState enforces the visibility of hidden files selected with --startup-state, and must be called
+// once "status_hidden" holds the value read at startup (and after prepareRestore, so that --restore-on-exit
+// restores the value from before the enforcement). With "keep", nothing is done. Otherwise the desired value is
+// written if it differs from the current one and the open File Explorer windows are refreshed. The enforced value
+// is stored as "startup_hidden" in the state.
+func (a *Application) applyStartupState() {
+	var desired uint64
+	switch flag.StartupState {
+	case startupShow:
+		desired = statusVisible
+	case startupHide:
+		desired = statusHidden
+	default:
+		return
+	}
+	state.Set("startup_hidden", desired)
+
+	current, _ := state.Get[uint64]("status_hidden")
+	if current == desired {
+		a.Logger.Debugf("'Hidden' value %d already matches startup state %q", current, flag.StartupState)
+		return
+	}
+
+	a.Logger.Infof("Enforcing startup state %q: setting 'Hidden' value from %d to %d", flag.StartupState, current, desired)
+	if err := a.Lib.SetHidden(desired); err != nil {
+		a.Logger.Errorf("Could not enforce startup state: %v", err)
+		return
+	}
+	if !a.Config.NoWatch {
+		// with --no-watch, SetHidden already refreshed the windows
+		a.refreshAfterWrite()
+	}
+}
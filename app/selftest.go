@@ -0,0 +1,103 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// selfTestValue is the scratch DWORD value that selfTest writes to, and then deletes from, the registry key to check
+// that it can be written.
+const selfTestValue = "ShowAllFilesSelfTest"
+
+// selfTestCheck is a single check run by selfTest.
+type selfTestCheck struct {
+	name string
+	run  func() (string, error)
+}
+
+// selfTest runs a sequence of checks verifying that the application can function on this machine and prints a
+// pass/fail report to stdout. The checks open the registry key, read "Hidden", arm a change notification as the
+// registry watcher does, enumerate File Explorer windows (without refreshing them), and perform a test write of the
+// scratch value selfTestValue, which is deleted again, so "Hidden" is never written. Returns ExitOK if every check
+// passed and ExitFatal otherwise.
+func (a *Application) selfTest() int {
+	checks := []selfTestCheck{
+		{"Open registry key", func() (string, error) {
+			key, err := registry.OpenKey(registry.CURRENT_USER, a.Config.KeyPath, registry.QUERY_VALUE|registry.SET_VALUE|registry.NOTIFY)
+			if err != nil {
+				return "", err
+			}
+
+			return `HKEY_CURRENT_USER\` + a.Config.KeyPath, key.Close()
+		}},
+		{"Read 'Hidden'", func() (string, error) {
+			value, err := a.Lib.GetValue("Hidden")
+
+			return fmt.Sprintf("value %d", value), err
+		}},
+		{"Watch for changes", func() (string, error) {
+			var hKey windows.Handle
+			if err := windows.RegOpenKeyEx(windows.HKEY_CURRENT_USER, windows.StringToUTF16Ptr(a.Config.KeyPath), 0, windows.KEY_NOTIFY, &hKey); err != nil {
+				return "", fmt.Errorf("failed call to RegOpenKeyEx: %v", err)
+			}
+			defer func() { _ = windows.RegCloseKey(hKey) }()
+
+			event, err := windows.CreateEvent(nil, 0, 0, nil)
+			if err != nil {
+				return "", fmt.Errorf("failed call to CreateEvent: %v", err)
+			}
+			defer func() { _ = windows.CloseHandle(event) }()
+
+			if err = windows.RegNotifyChangeKeyValue(hKey, true, windows.REG_NOTIFY_CHANGE_LAST_SET, event, true); err != nil {
+				return "", fmt.Errorf("failed call to RegNotifyChangeKeyValue: %v", err)
+			}
+
+			return "notification armed", nil
+		}},
+		{"Enumerate File Explorer windows", func() (string, error) {
+			return fmt.Sprintf("%d window(s) found", len(a.Lib.ExplorerWindows())), nil
+		}},
+		{"Test write", func() (string, error) {
+			key, err := registry.OpenKey(registry.CURRENT_USER, a.Config.KeyPath, registry.SET_VALUE)
+			if err != nil {
+				return "", err
+			}
+			defer func() { _ = key.Close() }()
+
+			if err = key.SetDWordValue(selfTestValue, 1); err != nil {
+				return "", fmt.Errorf("failed to write %q: %v", selfTestValue, err)
+			}
+			if err = key.DeleteValue(selfTestValue); err != nil {
+				return "", fmt.Errorf("failed to delete %q: %v", selfTestValue, err)
+			}
+
+			return fmt.Sprintf("%q written and deleted", selfTestValue), nil
+		}},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", check.name, err)
+			continue
+		}
+		fmt.Printf("PASS  %s (%s)\n", check.name, detail)
+	}
+
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", failed, len(checks))
+		return ExitFatal
+	}
+	fmt.Printf("All %d checks passed\n", len(checks))
+
+	return ExitOK
+}
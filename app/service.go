@@ -0,0 +1,255 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceRestartDelay is how long the service control manager waits before restarting the service once it stopped
+// with an error (see installService).
+const serviceRestartDelay = 5 * time.Second
+
+// serviceFlags lists the flags that are not forwarded to the service by --install-service.
+var serviceFlags = []string{"install-service", "uninstall-service", "console", "attach-pid", "verbose"}
+
+// serviceHandler runs the registry watcher of an Application under the Windows service control manager.
+type serviceHandler struct {
+	app *Application
+	sid string // SID of the user whose setting is watched, once one signed in (see consoleUser)
+}
+
+// Execute implements svc.Handler. It reports the service as running and starts the registry watcher (and the
+// reconciliation loop, if enabled) for the user signed in to the console (see watchConsoleUser), or, if nobody is,
+// once a user signs in. It then blocks until the service is stopped or the system shuts down, performing the same
+// cleanup as onExit before returning. If another user takes over the console, the service stops with ExitFatal, so
+// that the service control manager restarts it for that user (see installService). Errors sent to the
+// application's error channel are logged.
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.StartPending}
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown | svc.AcceptSessionChange}
+	h.app.Logger.Infof("Service started")
+
+	if err := h.watchConsoleUser(); err != nil {
+		h.app.Logger.Errorf("Error starting service: %v", err)
+		return false, ExitFatal
+	}
+
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				s <- svc.Status{State: svc.StopPending}
+				h.app.onExit()
+				return false, ExitOK
+			case svc.SessionChange:
+				if c.EventType != windows.WTS_SESSION_LOGON && c.EventType != windows.WTS_CONSOLE_CONNECT {
+					continue
+				}
+				if sid, _, err := consoleUser(); h.sid != "" && err == nil && sid != h.sid {
+					h.app.Logger.Infof("Another user signed in to the console; restarting the service to watch %s", sid)
+					s <- svc.Status{State: svc.StopPending}
+					h.app.onExit()
+					return false, ExitFatal
+				}
+				if err := h.watchConsoleUser(); err != nil {
+					h.app.Logger.Errorf("Error starting service: %v", err)
+					return false, ExitFatal
+				}
+			default:
+				h.app.Logger.Warnf("Unexpected service control request #%d", c.Cmd)
+			}
+
+		case err := <-h.app.ErrCh:
+			h.app.Logger.Errorf("%v", err)
+		}
+	}
+}
+
+// watchConsoleUser starts watching the setting of the user signed in to the console (see consoleUser) in their hive
+// under HKEY_USERS (see Config.UserSID), since the HKEY_CURRENT_USER of the service is that of its own account
+// (LocalSystem). Does nothing if a user is already watched, or if nobody is signed in yet. Returns an error if the
+// registry watcher cannot be started.
+func (h *serviceHandler) watchConsoleUser() error {
+	if h.sid != "" {
+		return nil
+	}
+
+	sid, name, err := consoleUser()
+	if err != nil {
+		h.app.Logger.Infof("Waiting for a user to sign in: %v", err)
+		return nil
+	}
+
+	h.sid, h.app.Config.UserSID = sid, sid
+	h.app.Logger.Infof("Watching the setting of %s (%s)", name, sid)
+
+	return h.app.startWatching()
+}
+
+// consoleUser returns the SID and the account name (as domain\user) of the user signed in to the active console
+// session, or an error if there is none (e.g., at the sign-in screen). Querying the user's token requires the
+// privilege to act as part of the operating system, which LocalSystem holds.
+func consoleUser() (sid string, name string, err error) {
+	session := windows.WTSGetActiveConsoleSessionId()
+	if session == 0xFFFFFFFF {
+		return "", "", errors.New("no active console session")
+	}
+
+	var token windows.Token
+	if err = windows.WTSQueryUserToken(session, &token); err != nil {
+		return "", "", fmt.Errorf("failed call to WTSQueryUserToken: %v", err)
+	}
+	defer func() { _ = token.Close() }()
+
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return "", "", fmt.Errorf("failed call to GetTokenUser: %v", err)
+	}
+
+	account, domain, _, err := user.User.Sid.LookupAccount("")
+	if err != nil {
+		return "", "", fmt.Errorf("failed call to LookupAccountSid: %v", err)
+	}
+
+	return user.User.Sid.String(), domain + `\` + account, nil
+}
+
+// runService runs the application as a Windows service until it is stopped. A service has no system tray, so it
+// runs as with --no-tray.
+func (a *Application) runService() {
+	a.Config.NoTray = true
+	if err := svc.Run(a.Meta.Name, &serviceHandler{app: a}); err != nil {
+		a.Logger.Errorf("Could not run service: %v", err)
+	}
+}
+
+// installService registers the running executable as an automatically started Windows service named after the
+// application. Flags given on the command line (except those in serviceFlags) are passed on to the service.
+// Requires administrator privileges. Returns the exit code for the command.
+func (a *Application) installService() int {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to locate executable: %v\n", err)
+		return ExitFatal
+	}
+
+	m, err := connectServiceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to the service manager: %v\n", err)
+		return ExitFatal
+	}
+	defer func() { _ = m.Disconnect() }()
+
+	if s, err := m.OpenService(a.Meta.Name); err == nil {
+		_ = s.Close()
+		fmt.Fprintf(os.Stderr, "Service %q is already installed\n", a.Meta.Name)
+		return ExitFatal
+	}
+
+	s, err := m.CreateService(a.Meta.Name, exe, mgr.Config{
+		DisplayName: a.Meta.Name,
+		Description: "Refreshes File Explorer when the setting to show hidden files changes",
+		StartType:   mgr.StartAutomatic,
+	}, serviceArgs()...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create service: %v\n", err)
+		return ExitFatal
+	}
+	defer func() { _ = s.Close() }()
+
+	// restart the service when it stops with ExitFatal, e.g., to watch another user's setting (see Execute)
+	if err = s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: serviceRestartDelay}}, 0); err == nil {
+		err = s.SetRecoveryActionsOnNonCrashFailures(true)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set the recovery actions of the service: %v\n", err)
+	}
+
+	if err = s.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Service %q installed, but failed to start: %v\n", a.Meta.Name, err)
+		return ExitFatal
+	}
+	fmt.Fprintf(os.Stderr, "Service %q installed and started\n", a.Meta.Name)
+
+	return ExitOK
+}
+
+// uninstallService stops and removes the Windows service installed by installService.
+// Requires administrator privileges. Returns the exit code for the command.
+func (a *Application) uninstallService() int {
+	m, err := connectServiceManager()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to connect to the service manager: %v\n", err)
+		return ExitFatal
+	}
+	defer func() { _ = m.Disconnect() }()
+
+	s, err := m.OpenService(a.Meta.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Service %q is not installed\n", a.Meta.Name)
+		return ExitFatal
+	}
+	defer func() { _ = s.Close() }()
+
+	if _, err = s.Control(svc.Stop); err != nil && !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		fmt.Fprintf(os.Stderr, "Failed to stop service: %v\n", err)
+	}
+	if err = s.Delete(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete service: %v\n", err)
+		return ExitFatal
+	}
+	fmt.Fprintf(os.Stderr, "Service %q uninstalled\n", a.Meta.Name)
+
+	return ExitOK
+}
+
+// connectServiceManager connects to the service control manager, explaining the likely cause if access is denied.
+func connectServiceManager() (*mgr.Mgr, error) {
+	m, err := mgr.Connect()
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return nil, errors.New("managing services requires running as administrator")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed call to Connect: %v", err)
+	}
+
+	return m, nil
+}
+
+// serviceArgs returns the flags given on the command line as arguments for the service,
+// skipping those listed in serviceFlags.
+func serviceArgs() []string {
+	var args []string
+	pflag.Visit(func(f *pflag.Flag) {
+		for _, name := range serviceFlags {
+			if f.Name == name {
+				return
+			}
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				args = append(args, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "--"+f.Name+"="+strings.TrimSpace(f.Value.String()))
+	})
+
+	return args
+}
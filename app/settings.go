@@ -0,0 +1,341 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// settingNames lists the DWORD values under regKeyPath that are exported with --export-settings
+// and that may be written with --import-settings, --set-dword, and --toggle-dword without --force.
+var settingNames = []string{
+	"Hidden",
+	"HideFileExt",
+	"ShowSuperHidden",
+	"SeparateProcess",
+	"ShowCompColor",
+	"ShowInfoTip",
+	"ShowStatusBar",
+	"LaunchTo",
+	"NavPaneExpandToCurrentFolder",
+	"NavPaneShowAllFolders",
+}
+
+// exportSettings reads each of the values listed in settingNames and writes them as a JSON object to the
+// file at path, or to stdout if path is "-". Values that do not exist are written as null. Only when writing to
+// stdout, --output=table prints them as a table instead (see outputFormat), since the JSON is what importSettings
+// reads. Returns the exit code for the command.
+func (a *Application) exportSettings(path string) int {
+	settings := make(map[string]*uint64, len(settingNames))
+	for _, name := range settingNames {
+		value, err := a.Lib.GetValue(name)
+		if errors.Is(err, registry.ErrNotExist) {
+			settings[name] = nil
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %q: %v\n", name, err)
+			return ExitFatal
+		}
+		settings[name] = &value
+	}
+
+	if path == "-" {
+		out := output{JSON: settings, Header: []string{"NAME", "VALUE"}}
+		for _, name := range settingNames {
+			value := "not set"
+			if settings[name] != nil {
+				value = strconv.FormatUint(*settings[name], 10)
+			}
+			out.Rows = append(out.Rows, []any{name, value})
+		}
+		if err := writeOutput(os.Stdout, outputFormat(outputJSON), out); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to print settings: %v\n", err)
+			return ExitFatal
+		}
+		return ExitOK
+	}
+
+	b, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode settings: %v\n", err)
+		return ExitFatal
+	}
+	if err = os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %q: %v\n", path, err)
+		return ExitFatal
+	}
+
+	return ExitOK
+}
+
+// statusReport is the JSON output of --status: the view settings (see ViewSettings) and the state of the registry
+// watcher of the running instance (see runningStatus), which is null if it could not be asked.
+type statusReport struct {
+	ViewSettings
+	WatcherRunning *bool  `json:"watcher_running"`
+	WatcherReady   *bool  `json:"watcher_ready"`
+	WatcherError   string `json:"watcher_error,omitempty"`
+}
+
+// printStatus prints whether hidden files, file extensions, and protected operating system files are shown, as read
+// by ViewSettings, as a table of each registry value and what it means, or with --output=json as a JSON object.
+// Since the registry watcher runs in the instance in the tray rather than in this process, whether it is running and
+// ready is asked from that instance's control server (see runningStatus), and reported as unknown if that fails.
+// Returns the exit code for the command.
+func (a *Application) printStatus() int {
+	settings, err := a.Lib.ViewSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read settings: %v\n", err)
+		return ExitFatal
+	}
+
+	shown := func(ok bool) string {
+		if ok {
+			return "shown"
+		}
+		return "hidden"
+	}
+	report := statusReport{ViewSettings: settings}
+	out := output{
+		JSON:   &report,
+		Header: []string{"NAME", "VALUE", "STATUS"},
+		Rows: [][]any{
+			{"Hidden", settings.Hidden, "hidden files " + shown(settings.Hidden == statusVisible)},
+			{"HideFileExt", settings.HideFileExt, "file extensions " + shown(settings.HideFileExt == 0)},
+			{"ShowSuperHidden", settings.ShowSuperHidden, "protected files " + shown(settings.ShowSuperHidden == 1)},
+		},
+	}
+
+	if status, err := runningStatus(flag.HTTP); err != nil {
+		out.Rows = append(out.Rows,
+			[]any{"watcher_running", "-", fmt.Sprintf("unknown (%v)", err)},
+			[]any{"watcher_ready", "-", "unknown"},
+		)
+	} else {
+		report.WatcherRunning, report.WatcherReady, report.WatcherError =
+			&status.WatcherRunning, &status.WatcherReady, status.WatcherError
+		running := "registry watcher running"
+		if !status.WatcherRunning {
+			running = "registry watcher stopped"
+			if status.WatcherError != "" {
+				running += ": " + status.WatcherError
+			}
+		}
+		ready := "registry watcher ready"
+		if !status.WatcherReady {
+			ready = "registry watcher initializing"
+		}
+		out.Rows = append(out.Rows,
+			[]any{"watcher_running", status.WatcherRunning, running},
+			[]any{"watcher_ready", status.WatcherReady, ready},
+		)
+	}
+
+	if err = writeOutput(os.Stdout, flag.Output, out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print status: %v\n", err)
+		return ExitFatal
+	}
+
+	return ExitOK
+}
+
+// importSettings reads a JSON object in the format written by exportSettings from the file at path and writes
+// each value back to the registry, then refreshes the open File Explorer windows. Null values are left unchanged.
+// Names not listed in settingNames are refused unless --force is set, and nothing is written if the file is
+// invalid. Returns the exit code for the command.
+func (a *Application) importSettings(path string) int {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %q: %v\n", path, err)
+		return ExitFatal
+	}
+
+	settings := map[string]*uint64{}
+	if err = json.Unmarshal(b, &settings); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid settings file %q: %v\n", path, err)
+		return ExitUsage
+	}
+
+	names := make([]string, 0, len(settings))
+	for name, value := range settings {
+		if !settingAllowed(name) {
+			fmt.Fprintf(os.Stderr, "Refusing to write unknown value %q without --force\n", name)
+			return ExitUsage
+		}
+		if value != nil && (a.readOnlyRefused(name) || invalidHidden(name, *value)) {
+			return ExitUsage
+		}
+		if value != nil && *value > math.MaxUint32 {
+			fmt.Fprintf(os.Stderr, "Value of %q is out of range for a DWORD: %d\n", name, *value)
+			return ExitUsage
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if settings[name] == nil {
+			continue
+		}
+		if err = a.writeValue(name, uint32(*settings[name])); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %q: %v\n", name, err)
+			return ExitFatal
+		}
+	}
+	a.refreshAfterWrite()
+
+	return ExitOK
+}
+
+// readOnlyRefused reports whether writing the registry value name is refused because of --read-only, which only
+// applies to "Hidden", printing why to stderr if so.
+//
+// Parameters:
+//
+//	name - The name of the registry value.
+func (a *Application) readOnlyRefused(name string) bool {
+	if !a.Config.ReadOnly || !strings.EqualFold(name, "Hidden") {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Refusing to write %q with --read-only\n", name)
+	return true
+}
+
+// invalidHidden reports whether value cannot be written to the registry value name because name is "Hidden", which
+// only takes statusVisible or statusHidden, printing why to stderr if so.
+//
+// Parameters:
+//
+//	name  - The name of the registry value.
+//	value - The value to write.
+func invalidHidden(name string, value uint64) bool {
+	if !strings.EqualFold(name, "Hidden") || value == statusVisible || value == statusHidden {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Invalid value %d for %q, expected %d or %d\n", value, name, statusVisible, statusHidden)
+	return true
+}
+
+// settingAllowed reports whether the registry value name may be written, either because it is listed in
+// settingNames (matched case-insensitively, like registry value names) or because --force is set.
+//
+// Parameters:
+//
+//	name - The name of the registry value.
+func settingAllowed(name string) bool {
+	return flag.Force || slices.ContainsFunc(settingNames, func(setting string) bool {
+		return strings.EqualFold(setting, name)
+	})
+}
+
+// setDword parses assignment as name=value, writes the DWORD value to the registry, then refreshes the open
+// File Explorer windows. The value may be given in decimal or, prefixed with 0x, in hexadecimal.
+// Returns the exit code for the command.
+//
+// Parameters:
+//
+//	assignment - The name and value to write, separated by "=".
+func (a *Application) setDword(assignment string) int {
+	name, raw, ok := strings.Cut(assignment, "=")
+	if !ok || name == "" {
+		fmt.Fprintf(os.Stderr, "Invalid assignment %q, expected name=value\n", assignment)
+		return ExitUsage
+	}
+	value, err := strconv.ParseUint(raw, 0, 32)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid DWORD value %q for %q: %v\n", raw, name, err)
+		return ExitUsage
+	}
+	if !settingAllowed(name) {
+		fmt.Fprintf(os.Stderr, "Refusing to write unknown value %q without --force\n", name)
+		return ExitUsage
+	}
+	if a.readOnlyRefused(name) || invalidHidden(name, value) {
+		return ExitUsage
+	}
+
+	if err = a.writeValue(name, uint32(value)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %q: %v\n", name, err)
+		return ExitFatal
+	}
+	a.refreshAfterWrite()
+
+	return ExitOK
+}
+
+// toggleDword flips the DWORD value name in the registry, then refreshes the open File Explorer windows and
+// prints the new value. "Hidden" is flipped between statusVisible and statusHidden; any other value is set to 0
+// if it is non-zero and to 1 otherwise, including when it does not exist yet. Returns the exit code for the
+// command.
+//
+// Parameters:
+//
+//	name - The name of the registry value.
+func (a *Application) toggleDword(name string) int {
+	if !settingAllowed(name) {
+		fmt.Fprintf(os.Stderr, "Refusing to write unknown value %q without --force\n", name)
+		return ExitUsage
+	}
+	if a.readOnlyRefused(name) {
+		return ExitUsage
+	}
+
+	value, err := a.Lib.GetValue(name)
+	if err != nil && !errors.Is(err, registry.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Failed to read %q: %v\n", name, err)
+		return ExitFatal
+	}
+
+	var next uint32
+	switch {
+	case strings.EqualFold(name, "Hidden") && value == statusHidden:
+		next = uint32(statusVisible)
+	case strings.EqualFold(name, "Hidden"):
+		next = uint32(statusHidden)
+	case value == 0:
+		next = 1
+	}
+
+	if err = a.writeValue(name, next); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %q: %v\n", name, err)
+		return ExitFatal
+	}
+	a.refreshAfterWrite()
+	fmt.Printf("%s=%d\n", name, next)
+
+	return ExitOK
+}
+
+// refreshAfterWrite refreshes the open File Explorer windows after a command changed a registry value (once the
+// change settled, see settle), unless --no-refresh is set so that scripts can batch several changes and run
+// --refresh once at the end.
+func (a *Application) refreshAfterWrite() {
+	if a.Config.NoRefresh {
+		return
+	}
+	settle(a.Logger, a.Config.SettleDelay)
+	a.Lib.RefreshExplorerWindows()
+}
+
+// refreshWindows refreshes all open File Explorer windows and prints how many were found.
+// Returns the exit code for the command.
+func (a *Application) refreshWindows() int {
+	fmt.Printf("Refreshed %d File Explorer windows\n", a.Lib.RefreshExplorerWindows())
+	return ExitOK
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/sirupsen/logrus"
+)
+
+// statusLine returns the line printed to the console by showStatusLine, e.g.,
+// "Hidden files: VISIBLE (changed via hotkey at 14:03:22)". The cause is left out if at is zero (i.e., for the
+// status at startup), and the source if it is unknown (e.g., for changes made by other tools).
+//
+// Parameters:
+//
+//	value  - The "Hidden" value (statusVisible or statusHidden).
+//	source - What changed the value (e.g., sourceHotkey), or "" if unknown.
+//	at     - When the value changed.
+func statusLine(value uint64, source string, at time.Time) string {
+	line := "Hidden files: HIDDEN"
+	if value == statusVisible {
+		line = "Hidden files: VISIBLE"
+	}
+
+	switch {
+	case at.IsZero():
+		return line
+	case source == "":
+		return fmt.Sprintf("%s (changed at %s)", line, at.Format(time.TimeOnly))
+	default:
+		return fmt.Sprintf("%s (changed via %s at %s)", line, source, at.Format(time.TimeOnly))
+	}
+}
+
+// showStatusLine starts a goroutine that prints a status line (see statusLine) to the console whenever
+// "status_hidden" changes (see state.Subscribe), starting with the current status, so that console users can follow
+// the state without reading the log. The source of a change is taken from "status_source" in the state, which is
+// set by the toggles that know it (see ToggleHidden) and consumed here. Only runs with a console (e.g., --verbose),
+// and neither with --no-status-line nor with a --log-level above INFO, which quiets the console like the log entries
+// the line is printed among. The goroutine returns when the application stops.
+func (a *Application) showStatusLine() {
+	if flag.NoStatusLine || consoleMode() == consoleNone || !log.IsLevelEnabled(logrus.InfoLevel) {
+		return
+	}
+
+	changes, cancel := state.Subscribe[uint64]("status_hidden")
+	goSafe(a.Logger, "status line", 0, func() {
+		defer cancel()
+
+		last, printed := state.Get[uint64]("status_hidden")
+		if printed {
+			writeConsoleLine(os.Stderr, statusLine(last, "", time.Time{}))
+		}
+		for {
+			select {
+			case value, ok := <-changes:
+				if !ok {
+					return
+				}
+				source, _ := state.Get[string]("status_source")
+				state.Delete("status_source")
+				if printed && value == last {
+					continue
+				}
+				last, printed = value, true
+				writeConsoleLine(os.Stderr, statusLine(value, source, time.Now()))
+			case <-a.done:
+				return
+			}
+		}
+	})
+}
+
+// writeConsoleLine writes line, followed by a newline, to w with a single write, as logrus writes each log entry,
+// so that it does not interleave with log output written to the same console. Log output buffered with --log-buffer
+// is flushed first, so that the line appears after the entries logged before it.
+//
+// Parameters:
+//
+//	w    - The console to write to (e.g., os.Stderr).
+//	line - The line to write.
+func writeConsoleLine(w io.Writer, line string) {
+	if logBuf != nil {
+		_ = logBuf.Flush()
+	}
+	_, _ = io.WriteString(w, line+"\n")
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+// stressSettle is how long the stress test waits after the last iteration for background work to finish
+// before taking the final measurements.
+const stressSettle = 2 * time.Second
+
+// stress is a soak test for maintainers (enabled with the hidden --stress flag). It flips the "Hidden" value
+// and refreshes all File Explorer windows for the given number of iterations, restores the original value,
+// and then compares the process handle count and number of goroutines with those measured beforehand.
+// The report is printed to stdout. Returns ExitOK if no leaks were detected and ExitFatal otherwise.
+//
+// Parameters:
+//
+//	iterations - The number of toggle and refresh cycles to run.
+func (a *Application) stress(iterations int) int {
+	_, original, err := a.Lib.GetKeyValuePair(true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read 'Hidden': %v\n", err)
+		return ExitFatal
+	}
+
+	// warm up once so lazily created resources (e.g., callbacks, DLLs) are not counted as leaks
+	a.Lib.RefreshExplorerWindows()
+	time.Sleep(stressSettle)
+
+	handlesBefore := processHandleCount()
+	goroutinesBefore := runtime.NumGoroutine()
+	start := time.Now()
+
+	value := original
+	for range iterations {
+		if value == statusHidden {
+			value = statusVisible
+		} else {
+			value = statusHidden
+		}
+		if err = a.Lib.SetHidden(value); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write 'Hidden': %v\n", err)
+			break
+		}
+		a.Lib.RefreshExplorerWindows()
+	}
+	elapsed := time.Since(start)
+
+	if err := a.Lib.SetHidden(original); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to restore 'Hidden' to %d: %v\n", original, err)
+	}
+	a.Lib.RefreshExplorerWindows()
+	time.Sleep(stressSettle)
+
+	handleLeaks := int(processHandleCount()) - int(handlesBefore)
+	goroutineLeaks := runtime.NumGoroutine() - goroutinesBefore
+
+	fmt.Printf("Iterations: %d in %s\n", iterations, elapsed)
+	fmt.Printf("Handles:    %d -> %d (leaked: %d)\n", handlesBefore, handlesBefore+uint32(max(handleLeaks, 0)), handleLeaks)
+	fmt.Printf("Goroutines: %d -> %d (leaked: %d)\n", goroutinesBefore, goroutinesBefore+goroutineLeaks, goroutineLeaks)
+
+	if err != nil || handleLeaks > 0 || goroutineLeaks > 0 {
+		return ExitFatal
+	}
+
+	return ExitOK
+}
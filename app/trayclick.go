@@ -0,0 +1,153 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/kamaranl/showallfiles/internal/state"
+	"github.com/kamaranl/winapi"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// systrayClass is the class name of the hidden window that getlantern/systray creates for the tray icon.
+	systrayClass = "SystrayClass"
+
+	// wmSystrayMessage is the callback message of the tray icon, as registered by getlantern/systray (WM_USER + 1).
+	wmSystrayMessage = 0x0400 + 1
+
+	// Mouse messages passed as the lParam of wmSystrayMessage, and the message posted by SetTimer.
+	wmTimer         = 0x0113
+	wmLButtonUp     = 0x0202
+	wmLButtonDblClk = 0x0203
+
+	// menuClass is the class name of popup menus, such as the tray menu.
+	menuClass = "#32768"
+
+	// gwlpWndProc is the index of the window procedure for SetWindowLongPtr (GWLP_WNDPROC).
+	gwlpWndProc = ^uintptr(3)
+
+	// trayClickTimerId identifies the timer that delays the tray menu until a double-click is ruled out.
+	trayClickTimerId = 1
+)
+
+// trayClicks subclasses the window of the tray icon so that double-clicking the icon sends to doubleClicked
+// instead of opening the menu. getlantern/systray opens the menu on any left or right click and has no click
+// handler of its own, so a left click only opens the menu once the double-click time passed without a second
+// click; right clicks are left alone. Its methods run on the thread of the systray's message loop.
+type trayClicks struct {
+	original      uintptr
+	swallowUp     bool
+	doubleClicked chan struct{}
+}
+
+// hookTrayClicks subclasses the tray icon's window of this process (see trayClicks) and returns the channel
+// that receives double-clicks of the icon. It must be called once systray.Run created the icon (e.g., in onReady).
+func hookTrayClicks() (<-chan struct{}, error) {
+	hwnd, err := findSystrayWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &trayClicks{doubleClicked: make(chan struct{}, 1)}
+	t.original, _, err = procSetWindowLongPtrW.Call(uintptr(hwnd), gwlpWndProc, windows.NewCallback(t.wndProc))
+	if t.original == 0 {
+		return nil, fmt.Errorf("failed call to SetWindowLongPtrW: %v", err)
+	}
+
+	return t.doubleClicked, nil
+}
+
+// findSystrayWindow returns the window of class systrayClass that belongs to this process, since other
+// applications built with getlantern/systray use the same class.
+func findSystrayWindow() (winapi.HWND, error) {
+	class, err := windows.UTF16PtrFromString(systrayClass)
+	if err != nil {
+		return 0, err
+	}
+
+	var hwnd uintptr
+	for {
+		hwnd, _, _ = procFindWindowExW.Call(0, hwnd, uintptr(unsafe.Pointer(class)), 0)
+		if hwnd == 0 {
+			return 0, errors.New("tray icon window not found")
+		}
+
+		var pid uint32
+		if _, err = windows.GetWindowThreadProcessId(winapi.HWND(hwnd), &pid); err == nil && pid == uint32(os.Getpid()) {
+			return winapi.HWND(hwnd), nil
+		}
+	}
+}
+
+// wndProc is the window procedure that replaces the one of getlantern/systray; every message it does not handle is
+// passed on to the original one. Every message of the tray icon (including the mouse moving over it) remembers the
+// foreground window (see rememberForeground) before a click can take the focus away from it. A left click starts a
+// timer of the system's double-click time, after which the click is passed on (opening the menu); a double-click
+// cancels the timer and swallows the click that ends it.
+func (t *trayClicks) wndProc(hwnd uintptr, msg uint32, wParam, lParam uintptr) uintptr {
+	defer recoverCallback(log, "trayClicks.wndProc")
+
+	if msg == wmSystrayMessage {
+		rememberForeground()
+	}
+
+	switch {
+	case msg == wmSystrayMessage && lParam == wmLButtonUp:
+		if t.swallowUp {
+			t.swallowUp = false
+			return 0
+		}
+		delay, _, _ := procGetDoubleClickTime.Call()
+		_, _, _ = procSetTimer.Call(hwnd, trayClickTimerId, delay, 0)
+		return 0
+	case msg == wmSystrayMessage && lParam == wmLButtonDblClk:
+		_, _, _ = procKillTimer.Call(hwnd, trayClickTimerId)
+		t.swallowUp = true
+		select {
+		case t.doubleClicked <- struct{}{}:
+		default:
+		}
+		return 0
+	case msg == wmTimer && wParam == trayClickTimerId:
+		_, _, _ = procKillTimer.Call(hwnd, trayClickTimerId)
+		msg, wParam, lParam = wmSystrayMessage, 0, wmLButtonUp
+	}
+
+	r1, _, _ := procCallWindowProcW.Call(t.original, hwnd, uintptr(msg), wParam, lParam)
+	return r1
+}
+
+// rememberForeground stores the foreground window as "tray_foreground" in the state, unless it is part of the
+// taskbar or of this process (see isTrayWindow), so that toggling from the tray menu can refresh the window the user
+// was working in rather than the taskbar or the menu, which hold the focus by then (see foregroundWindow).
+func rememberForeground() {
+	hwnd := windows.GetForegroundWindow()
+	if hwnd == 0 || isTrayWindow(hwnd) {
+		return
+	}
+	if last, _ := state.Get[winapi.HWND]("tray_foreground"); last != hwnd {
+		state.Set("tray_foreground", hwnd)
+	}
+}
+
+// isTrayWindow reports whether the specified window is part of the taskbar (including the notification area and
+// its overflow flyout), a popup menu, or a window of this process (e.g., the tray icon's).
+func isTrayWindow(hwnd winapi.HWND) bool {
+	switch className(hwnd) {
+	case "Shell_TrayWnd", "Shell_SecondaryTrayWnd", "NotifyIconOverflowWindow",
+		"TopLevelWindowForOverflowXamlIsland", menuClass:
+		return true
+	}
+
+	var pid uint32
+	_, err := windows.GetWindowThreadProcessId(hwnd, &pid)
+	return err == nil && pid == uint32(os.Getpid())
+}
@@ -1,6 +1,8 @@
 // Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
 // See LICENSE for licensing information
 
+//go:build windows
+
 // Package console provides functionality for attaching, detaching, spawning, and managing Windows console input and output streams.
 // It allows binding the current process to an existing console, allocating a new console, and restoring original standard IO streams.
 // The package handles preservation of original IO streams and ensures proper resource management when switching between console states.
@@ -25,24 +27,26 @@ var (
 	ErrNotBound = errors.New("console is not bound")
 )
 
-var (
-	stdin, stdout, stderr *os.File
-	preserved             bool
-)
-
 // Console represents a Windows console bound to the current process.
 // It allows attaching to an existing console, spawning a new one, or freeing the console,
-// and manages the associated input and output streams.
+// and manages the associated input and output streams. Each Console keeps its own copy of the standard IO
+// streams it restores on Detach, so that Consoles never interfere with one another.
 type Console struct {
-	infile, outfile *os.File
-	bound, debug    bool
+	infile, outfile       *os.File
+	stdin, stdout, stderr *os.File
+	bound, debug          bool
 }
 
-// New creates a new Console instance and preserves the original standard IO streams.
-// If debug is true, console operations will be skipped.
+// New creates a new Console instance and preserves the current standard IO streams, which Detach restores.
+// If debug is true, every console operation is a no-op that returns nil: the Console is never bound,
+// its files are never opened or closed, and the standard IO streams are neither preserved nor replaced.
 func New(debugger bool) *Console {
-	preserveIO()
-	return &Console{debug: debugger}
+	c := &Console{debug: debugger}
+	if !debugger {
+		c.preserveIO()
+	}
+
+	return c
 }
 
 // Attach binds the Console to an existing Windows console. If a PID is provided,
@@ -73,7 +77,13 @@ func (c *Console) Attach(pid ...uint32) error {
 	return nil
 }
 
-// Detach restores the original standard IO streams, closes the console files,
+// Bound reports whether the Console is bound to a Windows console, i.e., whether it was attached or spawned
+// and not detached since. It is always false in debug mode.
+func (c *Console) Bound() bool {
+	return c.bound
+}
+
+// Detach restores the standard IO streams preserved by New, closes the console files,
 // and frees the console if one is bound. Returns ErrNotBound if no console is attached.
 func (c *Console) Detach() error {
 	if c.debug {
@@ -83,14 +93,11 @@ func (c *Console) Detach() error {
 		return ErrNotBound
 	}
 
-	os.Stdin = stdin
-	os.Stdout = stdout
-	os.Stderr = stderr
+	os.Stdin = c.stdin
+	os.Stdout = c.stdout
+	os.Stderr = c.stderr
 
-	_ = c.infile.Close()
-	_ = c.outfile.Close()
-
-	c.infile, c.outfile = nil, nil
+	c.closeFiles()
 	c.bound = false
 
 	return c.Free()
@@ -132,6 +139,18 @@ func (c *Console) bindConsole(name string, hstd winapi.HSTDIO, file *os.File) er
 	return nil
 }
 
+// closeFiles closes the console input and output files if they were opened and clears the references to them.
+func (c *Console) closeFiles() {
+	if c.infile != nil {
+		_ = c.infile.Close()
+	}
+	if c.outfile != nil {
+		_ = c.outfile.Close()
+	}
+
+	c.infile, c.outfile = nil, nil
+}
+
 // launchConsole initializes and binds the console input and output streams for the Console instance.
 // It opens the Windows console input ("CONIN$") and output ("CONOUT$") files, binds them to the
 // standard handles (stdin, stdout, stderr), and updates the Console's internal file references.
@@ -172,14 +191,8 @@ func (c *Console) launchConsole() error {
 	return nil
 }
 
-// preserveIO saves the current standard input, output, and error streams
-// to global variables if they have not already been preserved. This ensures
-// that the original IO streams can be restored or referenced later in the program.
-func preserveIO() {
-	if preserved {
-		return
-	}
-
-	stdin, stdout, stderr = os.Stdin, os.Stdout, os.Stderr
-	preserved = true
+// preserveIO saves the current standard input, output, and error streams to the Console,
+// so that Detach can restore them once the console files replaced them.
+func (c *Console) preserveIO() {
+	c.stdin, c.stdout, c.stderr = os.Stdin, os.Stdout, os.Stderr
 }
@@ -0,0 +1,167 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build windows
+
+package console
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDebugLifecycle(t *testing.T) {
+	in, out, errOut := os.Stdin, os.Stdout, os.Stderr
+	c := New(true)
+
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Attach", func() error { return c.Attach() }},
+		{"AttachPid", func() error { return c.Attach(1) }},
+		{"Spawn", c.Spawn},
+		{"Detach", c.Detach},
+		{"DetachAgain", c.Detach},
+		{"Free", c.Free},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := step.fn(); err != nil {
+				t.Fatalf("%s() = %v, want nil", step.name, err)
+			}
+			if c.Bound() {
+				t.Errorf("%s() bound the console in debug mode", step.name)
+			}
+			if c.infile != nil || c.outfile != nil {
+				t.Errorf("%s() opened console files in debug mode", step.name)
+			}
+			if os.Stdin != in || os.Stdout != out || os.Stderr != errOut {
+				t.Errorf("%s() replaced the standard IO streams in debug mode", step.name)
+			}
+		})
+	}
+}
+
+func TestDetachNotBound(t *testing.T) {
+	c := New(false)
+	if err := c.Detach(); !errors.Is(err, ErrNotBound) {
+		t.Fatalf("Detach() = %v, want %v", err, ErrNotBound)
+	}
+	if c.infile != nil || c.outfile != nil {
+		t.Error("Detach() left console files set on an unbound console")
+	}
+}
+
+func TestCloseFilesNil(t *testing.T) {
+	c := &Console{}
+	c.closeFiles()
+	if c.infile != nil || c.outfile != nil {
+		t.Error("closeFiles() left console files set")
+	}
+}
+
+// swapStdio replaces the standard IO streams with temporary files for the duration of the test,
+// as if the test binary itself ran with redirected stdio, and returns the files.
+func swapStdio(t *testing.T) (in, out, errOut *os.File) {
+	t.Helper()
+
+	origIn, origOut, origErr := os.Stdin, os.Stdout, os.Stderr
+	t.Cleanup(func() { os.Stdin, os.Stdout, os.Stderr = origIn, origOut, origErr })
+
+	files := make([]*os.File, 3)
+	for i := range files {
+		f, err := os.CreateTemp(t.TempDir(), "stdio")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = f.Close() })
+		files[i] = f
+	}
+	os.Stdin, os.Stdout, os.Stderr = files[0], files[1], files[2]
+
+	return files[0], files[1], files[2]
+}
+
+// bindFake makes c look bound to a console by replacing the standard IO streams with temporary files,
+// as launchConsole does with the console files.
+func bindFake(t *testing.T, c *Console) {
+	t.Helper()
+
+	infile, err := os.CreateTemp(t.TempDir(), "conin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outfile, err := os.CreateTemp(t.TempDir(), "conout")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.infile, c.outfile = infile, outfile
+	os.Stdin, os.Stdout, os.Stderr = infile, outfile, outfile
+	c.bound = true
+}
+
+func TestPreserveIO(t *testing.T) {
+	in, out, errOut := swapStdio(t)
+
+	c := New(false)
+	if c.stdin != in || c.stdout != out || c.stderr != errOut {
+		t.Fatal("New() did not preserve the current standard IO streams")
+	}
+}
+
+func TestDetachRestoresIO(t *testing.T) {
+	in, out, errOut := swapStdio(t)
+	c := New(false)
+	bindFake(t, c)
+	infile, outfile := c.infile, c.outfile
+
+	_ = c.Detach() // FreeConsole fails without a console, after the streams are restored
+
+	if os.Stdin != in || os.Stdout != out || os.Stderr != errOut {
+		t.Error("Detach() did not restore the preserved standard IO streams")
+	}
+	if c.Bound() {
+		t.Error("Detach() left the console bound")
+	}
+	if c.infile != nil || c.outfile != nil {
+		t.Error("Detach() left console files set")
+	}
+	if _, err := infile.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Detach() left %q open", infile.Name())
+	}
+	if _, err := outfile.Stat(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Detach() left %q open", outfile.Name())
+	}
+}
+
+func TestDebugDoesNotPreserveIO(t *testing.T) {
+	swapStdio(t)
+
+	c := New(true)
+	if c.stdin != nil || c.stdout != nil || c.stderr != nil {
+		t.Error("New(true) preserved the standard IO streams in debug mode")
+	}
+}
+
+func TestConsolesIndependent(t *testing.T) {
+	in, out, errOut := swapStdio(t)
+	first := New(false)
+	bindFake(t, first)
+
+	// a Console created while the first is bound preserves the console files, not the original streams
+	second := New(false)
+	if second.stdout != first.outfile {
+		t.Fatal("New() did not preserve the current standard IO streams")
+	}
+	if debug := New(true); debug.stdout != nil {
+		t.Fatal("New(true) preserved the standard IO streams in debug mode")
+	}
+
+	_ = first.Detach()
+	if os.Stdin != in || os.Stdout != out || os.Stderr != errOut {
+		t.Error("Detach() did not restore the streams preserved by its own Console")
+	}
+}
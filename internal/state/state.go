@@ -8,8 +8,24 @@
 // Functions:
 //   - Get[T any](key string) (value T, ok bool): Retrieves a value of type T by key, returning the value and a boolean indicating success.
 //   - Set[T any](key string, value T): Stores a value of any type under the specified key.
+//   - SetStrict[T any](key string, value T) error: Like Set, but refuses to replace a value of a different type.
+//   - Update[T any](key string, fn func(old T, ok bool) T) T: Atomically replaces a value with the result of fn.
+//   - SetTTL[T any](key string, value T, ttl time.Duration, onExpire func()): Stores a value that expires after ttl.
+//   - ActiveTimers() []string: Lists the keys whose values are pending expiry.
+//   - Keys() []string: Lists the keys of all entries.
+//   - Len() int: Returns the number of entries.
+//   - CancelTimer(key string) bool: Removes a value pending expiry without calling its onExpire.
 //   - Delete(key string): Removes the entry associated with the given key.
-//   - Clear(): Removes all entries from the state.
+//   - Clear(): Removes all entries from the state and closes all subscriptions.
+//   - ClearExcept(keys ...string): Removes all entries except the given ones.
+//   - Subscribe[T any](key string) (<-chan T, func()): Receives the values subsequently stored under a key.
+//   - Save(path string, keys ...string) error: Persists the given entries to a JSON file.
+//   - Load(path string) error: Restores entries previously persisted with Save.
+//
+// Setting, deleting, or clearing a key cancels any pending expiry that was scheduled for it with SetTTL.
+// Entries restored with Load are kept in their JSON form and decoded into the requested type by Get.
+// Clearing the state closes the channels of the subscriptions to the cleared keys, so subscribers can
+// stop waiting; counters and any other values are reset along with every other cleared entry.
 //
 // Usage example:
 //
@@ -20,16 +36,34 @@
 package state
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
 var (
-	mu   sync.RWMutex
-	data = map[string]any{}
+	mu     sync.RWMutex
+	data   = map[string]any{}
+	timers = map[string]*time.Timer{}
+	subs   = map[string]map[int]*subscription{}
+	subId  int
 )
 
+// subscription delivers values stored under a key to a subscriber.
+type subscription struct {
+	notify func(v any)
+	close  func()
+}
+
 // Get retrieves a value of type T from the state using the provided key.
 // It returns the value and a boolean indicating whether the key was found and the value could be asserted to type T.
+// Values restored by Load are decoded from JSON into T instead of being asserted.
 // If the key does not exist or the value cannot be asserted to type T, the zero value of T and false are returned.
 func Get[T any](key string) (value T, ok bool) {
 	mu.RLock()
@@ -42,8 +76,7 @@ func Get[T any](key string) (value T, ok bool) {
 		return zero, false
 	}
 
-	value, ok = v.(T)
-	return
+	return as[T](v)
 }
 
 // Set stores a value of any type in the state map under the specified key.
@@ -55,22 +88,332 @@ func Get[T any](key string) (value T, ok bool) {
 //	value - the value to store, of any type
 func Set[T any](key string, value T) {
 	mu.Lock()
+	stopTimer(key)
 	data[key] = value
+	publish(key, value)
 	mu.Unlock()
 }
 
+// SetStrict stores a value in the state map under the specified key, like Set, unless the key already holds
+// a value of a different concrete type than T. In that case the existing value is left untouched and an error
+// is returned. Values restored by Load are considered compatible if they can be decoded into T.
+// It is meant to catch programming mistakes where a key is accidentally reused for another type.
+//
+// Parameters:
+//
+//	key   - the string key under which the value will be stored
+//	value - the value to store, of the same type as the existing value (if any)
+func SetStrict[T any](key string, value T) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if v, ok := data[key]; ok {
+		if _, ok := as[T](v); !ok {
+			return fmt.Errorf("cannot overwrite %T value of key %q with %T value", v, key, value)
+		}
+	}
+
+	stopTimer(key)
+	data[key] = value
+	publish(key, value)
+
+	return nil
+}
+
+// Update atomically replaces the value stored under key with the result of fn, which receives the current value
+// and whether it was present (and of type T), as Get would return them. fn runs under the write lock, so concurrent
+// read-modify-write operations (e.g., incrementing a counter or flipping a boolean) never lose updates.
+// fn must not call other functions of this package. Returns the stored value.
+//
+// Parameters:
+//
+//	key - the string key whose value is updated
+//	fn  - computes the new value from the current one
+func Update[T any](key string, fn func(old T, ok bool) T) T {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var old T
+	v, ok := data[key]
+	if ok {
+		old, ok = as[T](v)
+	}
+
+	value := fn(old, ok)
+	stopTimer(key)
+	data[key] = value
+	publish(key, value)
+
+	return value
+}
+
+// SetTTL stores a value of any type in the state map under the specified key and schedules its removal
+// once ttl has elapsed. If onExpire is non-nil, it is called (outside of the lock) after the entry is removed.
+// Overwriting or deleting the key before ttl elapses cancels the expiry, and onExpire is never called.
+//
+// Parameters:
+//
+//	key      - the string key under which the value will be stored
+//	value    - the value to store, of any type
+//	ttl      - how long the value remains stored
+//	onExpire - optional callback invoked after the value expires
+func SetTTL[T any](key string, value T, ttl time.Duration, onExpire func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	stopTimer(key)
+	data[key] = value
+	publish(key, value)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		mu.Lock()
+		if timers[key] != timer {
+			mu.Unlock()
+			return
+		}
+		delete(timers, key)
+		delete(data, key)
+		mu.Unlock()
+
+		if onExpire != nil {
+			onExpire()
+		}
+	})
+	timers[key] = timer
+}
+
+// ActiveTimers returns the sorted keys of the entries stored with SetTTL that have not expired yet.
+func ActiveTimers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	keys := make([]string, 0, len(timers))
+	for key := range timers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Keys returns the sorted keys of all entries in the state, including those pending expiry.
+// Along with Len, it makes the store observable, e.g., to spot entries that are never removed.
+func Keys() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Len returns the number of entries in the state, including those pending expiry.
+func Len() int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return len(data)
+}
+
+// CancelTimer cancels the pending expiry of the entry stored under key with SetTTL and removes the entry,
+// without calling its onExpire callback. It returns false, leaving the state unchanged, if no expiry is pending
+// for key (e.g., it has already expired or was stored with Set).
+//
+// Parameters:
+//
+//	key - the string key whose expiry is cancelled
+func CancelTimer(key string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := timers[key]; !ok {
+		return false
+	}
+	stopTimer(key)
+	delete(data, key)
+
+	return true
+}
+
 // Delete removes the entry associated with the given key from the shared data map.
 // It acquires a lock to ensure thread-safe access during the deletion.
 func Delete(key string) {
 	mu.Lock()
+	stopTimer(key)
 	delete(data, key)
 	mu.Unlock()
 }
 
 // Clear resets the internal state by acquiring a lock and reinitializing the data map.
-// This effectively removes all stored entries in a thread-safe manner.
+// This effectively removes all stored entries (including counters), cancels all pending expiries,
+// and closes the channels of all active subscriptions in a thread-safe manner.
 func Clear() {
+	ClearExcept()
+}
+
+// ClearExcept removes all entries except those stored under the given keys, which are left untouched along
+// with their pending expiries and subscriptions. The expiries of the removed entries are cancelled and the
+// channels of the subscriptions to any other key are closed. This allows transient entries to be discarded
+// while preserving persisted ones.
+func ClearExcept(keys ...string) {
+	keep := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keep[key] = true
+	}
+
 	mu.Lock()
-	data = make(map[string]any)
+	defer mu.Unlock()
+
+	for key := range timers {
+		if !keep[key] {
+			stopTimer(key)
+		}
+	}
+	for key := range data {
+		if !keep[key] {
+			delete(data, key)
+		}
+	}
+	for key, keySubs := range subs {
+		if keep[key] {
+			continue
+		}
+		for _, sub := range keySubs {
+			sub.close()
+		}
+		delete(subs, key)
+	}
+}
+
+// Subscribe returns a channel that receives every value of type T subsequently stored under key, along with
+// a function that cancels the subscription and closes the channel. The channel holds only the latest value,
+// so a slow subscriber misses intermediate values rather than blocking writers. Values of any other type
+// are not delivered. The channel is also closed when the key is removed by Clear or ClearExcept.
+func Subscribe[T any](key string) (<-chan T, func()) {
+	ch := make(chan T, 1)
+	var once sync.Once
+	sub := &subscription{
+		notify: func(v any) {
+			value, ok := as[T](v)
+			if !ok {
+				return
+			}
+			select {
+			case ch <- value:
+			default:
+				// drop the stale value so the latest one is delivered
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- value
+			}
+		},
+		close: func() { once.Do(func() { close(ch) }) },
+	}
+
+	mu.Lock()
+	subId++
+	id := subId
+	if subs[key] == nil {
+		subs[key] = map[int]*subscription{}
+	}
+	subs[key][id] = sub
 	mu.Unlock()
+
+	cancel := func() {
+		mu.Lock()
+		delete(subs[key], id)
+		mu.Unlock()
+		sub.close()
+	}
+
+	return ch, cancel
+}
+
+// Save writes the entries stored under the given keys to a JSON file at path, creating its directory if needed.
+// Keys that are not present in the state are omitted. Values must be encodable with encoding/json.
+func Save(path string, keys ...string) error {
+	mu.RLock()
+	entries := make(map[string]any, len(keys))
+	for _, key := range keys {
+		if v, ok := data[key]; ok {
+			entries[key] = v
+		}
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Load reads a JSON file previously written by Save and stores each of its entries in the state,
+// overwriting existing entries with the same key. A missing file is not an error.
+func Load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	entries := map[string]json.RawMessage{}
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	for key, raw := range entries {
+		stopTimer(key)
+		data[key] = raw
+		publish(key, raw)
+	}
+	mu.Unlock()
+
+	return nil
+}
+
+// as asserts v to type T, decoding it from JSON if it was restored by Load.
+// Returns the zero value of T and false if v cannot be represented as T.
+func as[T any](v any) (value T, ok bool) {
+	value, ok = v.(T)
+	if raw, isRaw := v.(json.RawMessage); isRaw && !ok {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			var zero T
+			return zero, false
+		}
+		ok = true
+	}
+
+	return value, ok
+}
+
+// publish delivers a newly stored value to the subscribers of the given key.
+// The caller must hold the write lock.
+func publish(key string, value any) {
+	for _, sub := range subs[key] {
+		sub.notify(value)
+	}
+}
+
+// stopTimer cancels the pending expiry for the given key, if any.
+// The caller must hold the write lock.
+func stopTimer(key string) {
+	if timer, ok := timers[key]; ok {
+		timer.Stop()
+		delete(timers, key)
+	}
 }
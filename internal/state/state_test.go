@@ -0,0 +1,280 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+package state
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	Clear()
+	Set("uint64", uint64(2))
+	Set("string", "alice")
+
+	tests := []struct {
+		name   string
+		get    func() (any, bool)
+		want   any
+		wantOk bool
+	}{
+		{"absent", func() (any, bool) { return Get[uint64]("absent") }, uint64(0), false},
+		{"matching uint64", func() (any, bool) { return Get[uint64]("uint64") }, uint64(2), true},
+		{"matching string", func() (any, bool) { return Get[string]("string") }, "alice", true},
+		{"mismatched int", func() (any, bool) { return Get[int]("uint64") }, 0, false},
+		{"mismatched uint32", func() (any, bool) { return Get[uint32]("uint64") }, uint32(0), false},
+		{"mismatched string", func() (any, bool) { return Get[string]("uint64") }, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.get()
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Get() = (%v, %v), want (%v, %v)", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestSetStrict(t *testing.T) {
+	Clear()
+
+	if err := SetStrict("key", uint64(1)); err != nil {
+		t.Fatalf("SetStrict() on absent key = %v, want nil", err)
+	}
+	if err := SetStrict("key", uint64(2)); err != nil {
+		t.Fatalf("SetStrict() with matching type = %v, want nil", err)
+	}
+	if err := SetStrict("key", uint32(3)); err == nil {
+		t.Fatal("SetStrict() with mismatched type = nil, want error")
+	}
+	if got, _ := Get[uint64]("key"); got != 2 {
+		t.Errorf("Get() after rejected SetStrict() = %d, want 2", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	Clear()
+
+	const goroutines, increments = 2, 1000
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				Update("counter", func(old int, ok bool) int { return old + 1 })
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := Get[int]("counter"); got != goroutines*increments {
+		t.Errorf("Get() after concurrent Update() = %d, want %d", got, goroutines*increments)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	Clear()
+	Set("key", true)
+	Delete("key")
+
+	if _, ok := Get[bool]("key"); ok {
+		t.Error("Get() after Delete() = ok, want not ok")
+	}
+}
+
+func TestActiveTimers(t *testing.T) {
+	Clear()
+	SetTTL("b", 1, time.Hour, nil)
+	SetTTL("a", 2, time.Hour, nil)
+	Set("plain", 3)
+
+	if got := ActiveTimers(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("ActiveTimers() = %q, want [a b]", got)
+	}
+
+	Set("b", 4)
+	if got := ActiveTimers(); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("ActiveTimers() after Set() = %q, want [a]", got)
+	}
+	Clear()
+	if got := ActiveTimers(); len(got) != 0 {
+		t.Errorf("ActiveTimers() after Clear() = %q, want none", got)
+	}
+}
+
+func TestCancelTimer(t *testing.T) {
+	Clear()
+	expired := make(chan struct{}, 1)
+	SetTTL("key", 1, 20*time.Millisecond, func() { expired <- struct{}{} })
+	Set("plain", 2)
+
+	if !CancelTimer("key") {
+		t.Fatal("CancelTimer() on pending key = false, want true")
+	}
+	if _, ok := Get[int]("key"); ok {
+		t.Error("Get() after CancelTimer() = ok, want not ok")
+	}
+	if CancelTimer("key") {
+		t.Error("CancelTimer() on cancelled key = true, want false")
+	}
+	if CancelTimer("plain") {
+		t.Error("CancelTimer() on key without expiry = true, want false")
+	}
+	if _, ok := Get[int]("plain"); !ok {
+		t.Error("Get() after CancelTimer() on key without expiry = not ok, want ok")
+	}
+
+	select {
+	case <-expired:
+		t.Error("onExpire called after CancelTimer()")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLen(t *testing.T) {
+	Clear()
+	if got := Len(); got != 0 {
+		t.Fatalf("Len() after Clear() = %d, want 0", got)
+	}
+
+	steps := []struct {
+		name string
+		fn   func()
+		want int
+	}{
+		{"Set", func() { Set("a", 1) }, 1},
+		{"Set other", func() { Set("b", "two") }, 2},
+		{"Set existing", func() { Set("a", 3) }, 2},
+		{"SetTTL", func() { SetTTL("c", 4, time.Hour, nil) }, 3},
+		{"Delete", func() { Delete("a") }, 2},
+		{"Delete absent", func() { Delete("a") }, 2},
+		{"CancelTimer", func() { CancelTimer("c") }, 1},
+		{"Clear", Clear, 0},
+	}
+	for _, step := range steps {
+		step.fn()
+		if got := Len(); got != step.want {
+			t.Errorf("Len() after %s = %d, want %d", step.name, got, step.want)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	Clear()
+	Set("b", 1)
+	SetTTL("a", 2, time.Hour, nil)
+
+	if got := Keys(); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("Keys() = %q, want [a b]", got)
+	}
+	Clear()
+	if got := Keys(); len(got) != 0 {
+		t.Errorf("Keys() after Clear() = %q, want none", got)
+	}
+}
+
+func TestClear(t *testing.T) {
+	Clear()
+	Set("a", 1)
+	Set("b", "two")
+	Clear()
+
+	if _, ok := Get[int]("a"); ok {
+		t.Error(`Get("a") after Clear() = ok, want not ok`)
+	}
+	if _, ok := Get[string]("b"); ok {
+		t.Error(`Get("b") after Clear() = ok, want not ok`)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	Clear()
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := "key" + strconv.Itoa(i%2)
+			for j := range 1000 {
+				Set(key, j)
+				_, _ = Get[int](key)
+				Delete(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSubscribe(t *testing.T) {
+	Clear()
+	ch, cancel := Subscribe[uint64]("status")
+	defer cancel()
+
+	Set("status", "wrong type")
+	Set("status", uint64(1))
+	Set("status", uint64(2))
+
+	if got := <-ch; got != 2 {
+		t.Errorf("received %d, want latest value 2", got)
+	}
+
+	cancel()
+	if _, open := <-ch; open {
+		t.Error("channel still open after cancel")
+	}
+}
+
+func TestClearClosesSubscriptions(t *testing.T) {
+	Clear()
+	ch, cancel := Subscribe[int]("counter")
+	defer cancel()
+
+	Set("counter", 1)
+	Clear()
+
+	if got, open := <-ch; !open || got != 1 {
+		t.Fatalf("received (%d, %v), want pending value (1, true)", got, open)
+	}
+	if _, open := <-ch; open {
+		t.Error("channel still open after Clear")
+	}
+	if _, ok := Get[int]("counter"); ok {
+		t.Error("counter not reset by Clear")
+	}
+}
+
+func TestClearExcept(t *testing.T) {
+	Clear()
+	kept, cancelKept := Subscribe[int]("kept")
+	defer cancelKept()
+	cleared, cancelCleared := Subscribe[int]("cleared")
+	defer cancelCleared()
+
+	Set("kept", 1)
+	Set("cleared", 2)
+	<-kept
+	<-cleared
+	ClearExcept("kept")
+
+	if v, ok := Get[int]("kept"); !ok || v != 1 {
+		t.Errorf(`Get("kept") = (%d, %v), want (1, true)`, v, ok)
+	}
+	if _, ok := Get[int]("cleared"); ok {
+		t.Error(`Get("cleared") after ClearExcept() = ok, want not ok`)
+	}
+	if _, open := <-cleared; open {
+		t.Error("subscription to cleared key still open")
+	}
+
+	Set("kept", 3)
+	if got := <-kept; got != 3 {
+		t.Errorf("kept subscription received %d, want 3", got)
+	}
+}
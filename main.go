@@ -6,14 +6,14 @@
 //go:generate windres resource.rc -O coff -o resource.syso
 
 // Package main provides the entry point for the ShowAllFiles application.
-// It initializes the main application logic from the internal app package,
+// It initializes the main application logic from the app package,
 // embeds version information, and starts the application run loop.
 package main
 
 import (
 	_ "embed"
 
-	"github.com/kamaranl/showallfiles/internal/app"
+	"github.com/kamaranl/showallfiles/app"
 )
 
 const (
@@ -29,6 +29,16 @@ This software is distributed "as-is" with NO WARRANTY.
 `
 )
 
+// About optionally overrides the text/template used for the About dialog, set at build time with
+// -ldflags "-X 'main.About=...'" (e.g., to show a support contact in internal deployments).
+// When empty, the default format is used.
+var About string
+
+// ReportURL optionally overrides the page opened by the "Report bug" menu item, set at build time with
+// -ldflags "-X 'main.ReportURL=...'" (e.g., to point forks or internal builds at their own issue tracker).
+// When empty, the upstream issues page is used.
+var ReportURL string
+
 // Version holds the application version, embedded at build time from the VERSION file.
 // It is used to display version information in the application and via command-line flags.
 //
@@ -41,5 +51,9 @@ func main() {
 	a := app.New(Name)
 	a.Meta.Version = Version
 	a.Meta.License = License
+	a.Meta.About = About
+	if ReportURL != "" {
+		a.Meta.ReportURL = ReportURL
+	}
 	a.Run()
 }
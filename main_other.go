@@ -0,0 +1,20 @@
+// Copyright (c) 2025, Kamaran Layne <kamaran@layne.dev>
+// See LICENSE for licensing information
+
+//go:build !windows
+
+// Package main provides the entry point for the ShowAllFiles application.
+// On platforms other than Windows, it only explains that the application is Windows-only.
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// main reports that ShowAllFiles cannot run on this platform and exits with a non-zero status.
+func main() {
+	fmt.Fprintf(os.Stderr, "ShowAllFiles is Windows-only and cannot run on %s\n", runtime.GOOS)
+	os.Exit(1)
+}